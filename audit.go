@@ -0,0 +1,112 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// AuditEntry is a moderation action recorded in the audit log
+type AuditEntry struct {
+	Time     time.Time `json:"time"`
+	ChatID   int64     `json:"chat_id"`
+	UserID   int       `json:"user_id,omitempty"`
+	UserName string    `json:"user_name,omitempty"`
+	Action   string    `json:"action"`
+	Reason   string    `json:"reason,omitempty"`
+	Actor    string    `json:"actor,omitempty"`
+}
+
+// auditFile is a JSON line file with all the moderation actions
+var auditFile = "audit.jsonl"
+
+var auditMutex sync.Mutex
+
+// commandActor return the username of who sent the command
+func commandActor(update *telegram.Update) string {
+	if update.Message.From == nil {
+		return ""
+	}
+	return update.Message.From.UserName
+}
+
+// chatLink return a link to the chat, supergroups and channels have
+// a -100 prefix removed on links
+func chatLink(chatID int64) string {
+	id := strconv.FormatInt(chatID, 10)
+	if strings.HasPrefix(id, "-100") {
+		return fmt.Sprintf("https://t.me/c/%s", strings.TrimPrefix(id, "-100"))
+	}
+	return ""
+}
+
+// auditSummary return the entry formatted as HTML for the log chat
+func auditSummary(locale string, entry AuditEntry) string {
+	lines := []string{fmt.Sprintf("<b>%s</b>", html.EscapeString(entry.Action))}
+	if entry.UserID != 0 {
+		name := entry.UserName
+		if name == "" {
+			name = strconv.Itoa(entry.UserID)
+		}
+		lines = append(lines, fmt.Sprintf(
+			`%s: <a href="tg://user?id=%d">%s</a> (%d)`,
+			tr(locale, "audit_user", nil), entry.UserID, html.EscapeString(name), entry.UserID,
+		))
+	}
+	if link := chatLink(entry.ChatID); link != "" {
+		lines = append(lines, fmt.Sprintf(`%s: <a href="%s">%d</a>`, tr(locale, "audit_chat", nil), link, entry.ChatID))
+	} else {
+		lines = append(lines, fmt.Sprintf("%s: %d", tr(locale, "audit_chat", nil), entry.ChatID))
+	}
+	if entry.Reason != "" {
+		lines = append(lines, fmt.Sprintf("%s: %s", tr(locale, "audit_reason", nil), html.EscapeString(entry.Reason)))
+	}
+	if entry.Actor != "" {
+		lines = append(lines, fmt.Sprintf("%s: @%s", tr(locale, "audit_actor", nil), html.EscapeString(entry.Actor)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// auditLog append the entry to the auditFile and post it to the log chat
+func auditLog(bot TrollShieldBot, entry AuditEntry) {
+	if config.LogChat != 0 {
+		msg := telegram.NewMessage(config.LogChat, auditSummary(chatLocale(config.LogChat), entry))
+		msg.ParseMode = telegram.ModeHTML
+		msg.DisableWebPagePreview = true
+		if _, err := bot.Send(msg); err != nil {
+			log.Printf("[!] Posting to the log chat failed: %v", err)
+		}
+	}
+
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("[!] Encoding audit entry failed: %v", err)
+		return
+	}
+
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	f, err := os.OpenFile(auditFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	if err == nil {
+		_, err = f.Write(append(line, '\n'))
+		if e := f.Close(); e != nil {
+			err = e
+		}
+	}
+	if err != nil {
+		log.Printf("[!] Writing audit log failed: %v", err)
+	}
+}
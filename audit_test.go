@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestAuditLog(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "audit.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+	defer func(f string) { auditFile = f }(auditFile)
+	auditFile = tmpfile.Name()
+
+	auditLog(&BotMockup{}, AuditEntry{ChatID: 1, UserID: 2, Action: actionBan, Reason: "@trollhouse"})
+	auditLog(&BotMockup{}, AuditEntry{ChatID: 1, Action: "leave"})
+
+	data, err := ioutil.ReadFile(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("audit log should have 2 entries, got %v", len(lines))
+	}
+	var entry AuditEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.UserID != 2 || entry.Action != actionBan || entry.Time.IsZero() {
+		t.Errorf("unexpected audit entry: %+v", entry)
+	}
+}
+
+func TestAuditSummary(t *testing.T) {
+	entry := AuditEntry{
+		ChatID:   -1001280636766,
+		UserID:   42,
+		UserName: "<troll>",
+		Action:   actionBan,
+		Reason:   "@trollhouse",
+		Actor:    "lerax",
+	}
+	expected := strings.Join([]string{
+		"<b>ban</b>",
+		`Usuário: <a href="tg://user?id=42">&lt;troll&gt;</a> (42)`,
+		`Grupo: <a href="https://t.me/c/1280636766">-1001280636766</a>`,
+		"Motivo: @trollhouse",
+		"Por: @lerax",
+	}, "\n")
+	if got := auditSummary("pt", entry); got != expected {
+		t.Errorf("auditSummary expected %q, got %q", expected, got)
+	}
+
+	expected = "<b>leave</b>\nChat: -5"
+	if got := auditSummary("en", AuditEntry{ChatID: -5, Action: "leave"}); got != expected {
+		t.Errorf("auditSummary expected %q, got %q", expected, got)
+	}
+}
+
+func TestAuditLogChat(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(f string) { auditFile = f }(auditFile)
+	auditFile = os.DevNull
+	config = &Config{LogChat: -100}
+	bot := SentMockup{}
+	auditLog(&bot, AuditEntry{ChatID: 1, Action: "leave"})
+	if len(bot.sent) != 1 {
+		t.Fatalf("auditLog should post to the log chat")
+	}
+	if msg := bot.sent[0].(telegram.MessageConfig); msg.ChatID != -100 || msg.ParseMode != telegram.ModeHTML {
+		t.Errorf("auditLog should post HTML to the log chat, got %+v", msg)
+	}
+}
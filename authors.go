@@ -0,0 +1,30 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"context"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// checkAuthor check the author of a message against the troll groups,
+// catching the members which joined before the bot. Return true if the
+// author was kicked.
+func checkAuthor(bot TrollShieldBot, botHidden TrollShieldBot, update *telegram.Update) bool {
+	author := update.Message.From
+	if author == nil || author.IsBot || fromAdminEvent(update) || store.trusted(author.ID) {
+		return false
+	}
+	trollHouse := checkTrollHouses(context.Background(), bot, botHidden, update.Message.Chat.ID, *author)
+	store.checkedMember(update.Message.Chat.ID, author.ID)
+	if trollHouse == "" {
+		return false
+	}
+	if err := kickTroll(bot, update, *author, trollHouse); err != nil {
+		return false
+	}
+	store.forgetMember(update.Message.Chat.ID, author.ID)
+	return true
+}
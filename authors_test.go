@@ -0,0 +1,43 @@
+package main
+
+import (
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestCheckAuthor(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	defer func(g []string) { trollGroups = g }(trollGroups)
+	store = newStore("")
+	trollGroups = []string{"@rolisvaldo"}
+	bot := BotMockup{}
+	chat := telegram.Chat{ID: -1, Type: "supergroup"}
+	// the mockup finds user 1 in any group, but only kicks user 0
+	author := telegram.User{ID: 1, UserName: "legacy"}
+	update := telegram.Update{Message: &telegram.Message{Chat: &chat, From: &author}}
+
+	if !updateRoster(&update) {
+		t.Errorf("first message of the author should be reported as new")
+	}
+	if updateRoster(&update) {
+		t.Errorf("second message of the author should not be reported as new")
+	}
+	if checkAuthor(&bot, &bot, &update) {
+		t.Errorf("checkAuthor should not report a kick when kicking fails")
+	}
+	if store.Roster[-1][1].Checked.IsZero() {
+		t.Errorf("checkAuthor should record the check")
+	}
+
+	author.ID = 4
+	if checkAuthor(&bot, &bot, &update) {
+		t.Errorf("checkAuthor should not kick users outside the troll groups")
+	}
+
+	author.ID = 1
+	store.trust(author)
+	if checkAuthor(&bot, &bot, &update) {
+		t.Errorf("checkAuthor should not check trusted users")
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// parseBan parse the arguments of /ban [duration] [reason], a ban
+// without duration is permanent
+func parseBan(command string) (KickPolicy, string) {
+	args := commandArgs(command)
+	policy := KickPolicy{Action: actionPermanent}
+	if len(args) > 0 {
+		if d, err := parseDuration(args[0]); err == nil && d > 0 {
+			policy = KickPolicy{Action: actionBan, Duration: Duration(d)}
+			args = args[1:]
+		}
+	}
+	return policy, strings.Join(args, " ")
+}
+
+// banUser ban the author of the replied message and delete that message, parse:
+// - /ban [duration] [reason]
+func banUser(bot TrollShieldBot, update *telegram.Update) {
+	replied := update.Message.ReplyToMessage
+	if replied == nil || replied.From == nil {
+		replyMessage(bot, update, "ban_usage", nil)
+		return
+	}
+	user := *replied.From
+	chatID := update.Message.Chat.ID
+	policy, reason := parseBan(update.Message.Text)
+
+	chatMember := telegram.ChatMemberConfig{ChatID: chatID, UserID: user.ID}
+	if resp, err := applyPolicy(bot, chatMember, policy); !resp.Ok || err != nil {
+		log.Printf("[!] Banning %v did not work, error code %v: %v", user.ID, resp.ErrorCode, resp.Description)
+		replyMessage(bot, update, "ban_failed", vars{"User": user})
+		return
+	}
+	deleteMessage(bot, chatID, replied.MessageID)
+
+	username := getUserName(user)
+	offences := store.addOffence(user, reason, policy.Action)
+	store.forgetMember(chatID, user.ID)
+	auditLog(bot, AuditEntry{
+		ChatID:   chatID,
+		UserID:   user.ID,
+		UserName: username,
+		Action:   policy.Action,
+		Reason:   reason,
+		Actor:    commandActor(update),
+	})
+
+	motive := tr(chatLocale(chatID), "motive_admin", vars{"Reason": reason})
+	announceRemoval(bot, update, removalNotice(chatID, user, policy, motive, offences))
+}
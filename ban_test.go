@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestParseBan(t *testing.T) {
+	tableTest := []struct {
+		command string
+		policy  KickPolicy
+		reason  string
+	}{
+		{"/ban", KickPolicy{Action: actionPermanent}, ""},
+		{"/ban spam", KickPolicy{Action: actionPermanent}, "spam"},
+		{"/ban 1d", KickPolicy{Action: actionBan, Duration: Duration(24 * time.Hour)}, ""},
+		{"/ban 2w spam de links", KickPolicy{Action: actionBan, Duration: Duration(14 * 24 * time.Hour)}, "spam de links"},
+	}
+	for _, test := range tableTest {
+		if policy, reason := parseBan(test.command); policy != test.policy || reason != test.reason {
+			t.Errorf("parseBan(%q): expected %+v %q, got %+v %q", test.command, test.policy, test.reason, policy, reason)
+		}
+	}
+}
+
+func TestBanUser(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+	bot := SentMockup{}
+	troll := telegram.User{ID: 0, UserName: "troll"}
+	update := telegram.Update{Message: &telegram.Message{
+		Text:           "/ban 1d spam",
+		Chat:           &telegram.Chat{},
+		From:           &telegram.User{UserName: "lerax"},
+		ReplyToMessage: &telegram.Message{MessageID: 10, From: &troll},
+	}}
+
+	banUser(&bot, &update)
+	expected := "@troll foi banido por 1 dia porque um administrador decidiu: spam (ofensa nº 1)."
+	if got := bot.lastText(); !strings.HasPrefix(got, expected) {
+		t.Errorf("banUser expected %q, got %q", expected, got)
+	}
+	if offences := store.offences(troll.ID); offences != 1 {
+		t.Errorf("banUser should record the offence, got %v", offences)
+	}
+
+	// the mockup can't kick other users than 0
+	troll.ID = 1
+	banUser(&bot, &update)
+	if got := bot.lastText(); !strings.HasPrefix(got, "Não consegui banir") {
+		t.Errorf("banUser should reply the failure, got %q", got)
+	}
+
+	update.Message.ReplyToMessage = nil
+	banUser(&bot, &update)
+	if got := bot.lastText(); !strings.HasPrefix(got, "Uso: /ban") {
+		t.Errorf("banUser should reply the usage, got %q", got)
+	}
+}
@@ -0,0 +1,171 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBanListInterval = 24 * time.Hour
+	banListFetchTimeout    = time.Minute
+)
+
+var banListClient = &http.Client{Timeout: banListFetchTimeout}
+
+// readBanList read the ban list from an http(s) URL or a local file
+func readBanList(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return ioutil.ReadFile(source)
+	}
+	data, err := download(source)
+	if err != nil {
+		return nil, fmt.Errorf("fetching %v: %v", source, err)
+	}
+	return data, nil
+}
+
+// download fetch the URL without it in the errors, since the URLs of the
+// telegram files have the token of the bot
+func download(link string) ([]byte, error) {
+	resp, err := banListClient.Get(link)
+	if err != nil {
+		return nil, hideURL(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download failed: %v", resp.Status)
+	}
+	data, err := ioutil.ReadAll(resp.Body)
+	return data, hideURL(err)
+}
+
+// hideURL return the error of a request without its URL, which may have
+// the token of the bot
+func hideURL(err error) error {
+	if e, ok := err.(*url.Error); ok {
+		return fmt.Errorf("%v failed: %v", e.Op, e.Err)
+	}
+	return err
+}
+
+// parseBanList decode the user IDs of a ban list, which is a JSON array
+// of IDs or of objects with "user_id" or "id", or a CSV with the IDs in
+// the first column, like one ID per line. Lines without an ID, like the
+// headers, are skipped.
+func parseBanList(data []byte) ([]int, error) {
+	data = bytes.TrimSpace(data)
+	if bytes.HasPrefix(data, []byte("[")) {
+		return parseBanListJSON(data)
+	}
+
+	var ids []int
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return ids, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if id, err := strconv.Atoi(strings.TrimSpace(record[0])); err == nil {
+			ids = append(ids, id)
+		}
+	}
+}
+
+func parseBanListJSON(data []byte) ([]int, error) {
+	var items []json.RawMessage
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		var id int
+		if err := json.Unmarshal(item, &id); err == nil {
+			ids = append(ids, id)
+			continue
+		}
+		var entry struct {
+			ID     int `json:"id"`
+			UserID int `json:"user_id"`
+		}
+		if err := json.Unmarshal(item, &entry); err != nil {
+			return nil, err
+		}
+		if entry.UserID != 0 {
+			ids = append(ids, entry.UserID)
+		} else if entry.ID != 0 {
+			ids = append(ids, entry.ID)
+		}
+	}
+	return ids, nil
+}
+
+// refreshBanLists import every ban list of the config into the store,
+// keeping the previous import of the lists failing to load, and save them
+func refreshBanLists() {
+	defer store.saveBanLists()
+	store.keepBanLists(config.BanLists)
+	for _, source := range config.BanLists {
+		data, err := readBanList(source)
+		if err == nil {
+			var ids []int
+			if ids, err = parseBanList(data); err == nil {
+				store.setBanList(source, ids)
+				log.Printf("Imported %v users from the ban list %v", len(ids), source)
+				continue
+			}
+		}
+		log.Printf("[!] Importing the ban list %v failed: %v", source, err)
+	}
+}
+
+// refreshImports merge the blocklists queued by the command line and
+// import the ban lists, when there are some
+func refreshImports() {
+	mergeBlocklistQueue(blocklistQueueFile)
+	if len(config.BanLists) > 0 {
+		refreshBanLists()
+	}
+}
+
+// startBanLists import the ban lists and the queued blocklists now and
+// then at the interval
+func startBanLists() {
+	interval := time.Duration(config.BanListInterval)
+	if interval <= 0 {
+		interval = defaultBanListInterval
+	}
+	go func() {
+		refreshImports()
+		for range time.Tick(interval) {
+			refreshImports()
+		}
+	}()
+}
+
+// detectBanLists find the ban lists with the user
+func detectBanLists(ctx context.Context, d Detection) (Verdict, error) {
+	source := store.bannedBy(d.User.ID)
+	if source == "" {
+		return Verdict{}, nil
+	}
+	return Verdict{Hits: 1, Evidence: []string{source}}, nil
+}
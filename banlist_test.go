@@ -0,0 +1,132 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestParseBanList(t *testing.T) {
+	tableTest := []struct {
+		data     string
+		expected []int
+	}{
+		{"1\n2\n\n3\n", []int{1, 2, 3}},
+		{"user_id,offenses,time_added\n10,3,2020-07-01\n20,1,2020-07-02\n", []int{10, 20}},
+		{"# CAS export\n 30 \n", []int{30}},
+		{`[40, 50]`, []int{40, 50}},
+		{` [{"user_id": 60}, {"id": 70}]`, []int{60, 70}},
+	}
+	for _, test := range tableTest {
+		got, err := parseBanList([]byte(test.data))
+		if err != nil {
+			t.Errorf("parseBanList(%q) failed: %v", test.data, err)
+			continue
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("parseBanList(%q): expected %v, got %v", test.data, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("parseBanList(%q): expected %v, got %v", test.data, test.expected, got)
+				break
+			}
+		}
+	}
+
+	if _, err := parseBanList([]byte(`[{"user_id": "x"}]`)); err == nil {
+		t.Errorf("parseBanList should fail with invalid JSON entries")
+	}
+}
+
+func TestStoreBanLists(t *testing.T) {
+	s := newStore("")
+	s.setBanList("a", []int{1, 2})
+	s.setBanList("b", []int{3})
+	s.setBanList("a", []int{2})
+	if got := s.bannedBy(1); got != "" {
+		t.Errorf("setBanList should replace the previous import, got %q", got)
+	}
+	if got := s.bannedBy(3); got != "b" {
+		t.Errorf("bannedBy expected b, got %q", got)
+	}
+	s.keepBanLists([]string{"a"})
+	if got := s.bannedBy(3); got != "" {
+		t.Errorf("keepBanLists should forget the other lists, got %q", got)
+	}
+}
+
+func TestRefreshBanLists(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+
+	tmpfile, err := ioutil.TempFile("", "banlist.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	if _, err := tmpfile.WriteString("1\n2\n"); err != nil {
+		t.Fatal(err)
+	}
+	tmpfile.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/cas.json" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[3]`))
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "troll-shield")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store = loadStore(filepath.Join(dir, "store.json"))
+	store.loadBanLists(filepath.Join(dir, "banlists.json"))
+
+	config = &Config{BanLists: []string{tmpfile.Name(), server.URL + "/cas.json", server.URL + "/missing"}}
+	store.setBanList(server.URL+"/missing", []int{4})
+	refreshBanLists()
+	for id, source := range map[int]string{1: tmpfile.Name(), 3: server.URL + "/cas.json", 4: server.URL + "/missing"} {
+		if got := store.bannedBy(id); got != source {
+			t.Errorf("refreshBanLists expected %v in %q, got %q", id, source, got)
+		}
+	}
+
+	store.exempt(telegram.User{ID: 5})
+	if dat, _ := ioutil.ReadFile(filepath.Join(dir, "store.json")); strings.Contains(string(dat), "cas.json") {
+		t.Errorf("the store should not keep the ban lists, got %s", dat)
+	}
+	saved := loadStore(filepath.Join(dir, "store.json"))
+	saved.loadBanLists(filepath.Join(dir, "banlists.json"))
+	if got := saved.bannedBy(3); got != server.URL+"/cas.json" {
+		t.Errorf("refreshBanLists should save the ban lists, got %q", got)
+	}
+}
+
+func TestScreenMemberBanList(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	config, _ = parseConfig([]byte(`{"ban_lists": ["cas.csv"]}`))
+	store = newStore("")
+	store.setBanList("cas.csv", []int{0})
+	bot := SentMockup{}
+	update := telegram.Update{Message: &telegram.Message{Chat: &telegram.Chat{ID: -1}}}
+
+	if !screenMember(&bot, &bot, &update, telegram.User{ID: 0, UserName: "spammer"}, false) {
+		t.Errorf("screenMember should kick the users in ban lists")
+	}
+	if got := bot.lastText(); !strings.Contains(got, "está na lista de banimento: cas.csv") {
+		t.Errorf("screenMember should announce the ban list, got %q", got)
+	}
+}
@@ -0,0 +1,329 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// blocklistVersion is the version of the blocklist format written by
+// this bot, which reads the older ones too
+const blocklistVersion = 1
+
+const (
+	defaultBlocklistKey    = "blocklist.key"
+	defaultBlocklistIssuer = "troll-shield"
+)
+
+// blocklistQueueFile keeps the blocklists imported by the command line
+// until the running bot merges them into its store
+var blocklistQueueFile = "blocklist-queue.json"
+
+var (
+	errBlocklistSignature = errors.New("invalid blocklist signature")
+	errBlocklistUntrusted = errors.New("blocklist signed by an untrusted key")
+)
+
+// Blocklist is the signed list of trolls shared between the instances
+// of the bot. The signature covers the list encoded without it.
+type Blocklist struct {
+	Version   int            `json:"version"`
+	Issuer    string         `json:"issuer"`
+	Created   time.Time      `json:"created"`
+	Users     []BlockedUser  `json:"users"`
+	Groups    []BlockedGroup `json:"groups"`
+	PublicKey string         `json:"public_key"`
+	Signature string         `json:"signature,omitempty"`
+}
+
+// blocklistIssuer return the name of this instance in the blocklists
+func blocklistIssuer() string {
+	if config.BlocklistIssuer != "" {
+		return config.BlocklistIssuer
+	}
+	return defaultBlocklistIssuer
+}
+
+// loadSigningKey read the private key from the base64 seed in fpath,
+// generating and saving a new one when the file doesn't exist
+func loadSigningKey(fpath string) (ed25519.PrivateKey, error) {
+	data, err := ioutil.ReadFile(fpath)
+	if os.IsNotExist(err) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		seed := base64.StdEncoding.EncodeToString(key.Seed())
+		if err := ioutil.WriteFile(fpath, []byte(seed+"\n"), 0600); err != nil {
+			return nil, err
+		}
+		log.Printf("Generated the blocklist key %q", fpath)
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid blocklist key %q", fpath)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// signingKey load the blocklist key of the config
+func signingKey() (ed25519.PrivateKey, error) {
+	if config.BlocklistKey != "" {
+		return loadSigningKey(config.BlocklistKey)
+	}
+	return loadSigningKey(defaultBlocklistKey)
+}
+
+// payload return the encoded blocklist without the signature
+func (list Blocklist) payload() ([]byte, error) {
+	list.Signature = ""
+	return json.Marshal(list)
+}
+
+// sign the blocklist with the key, setting its public key
+func (list *Blocklist) sign(key ed25519.PrivateKey) error {
+	list.PublicKey = base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))
+	payload, err := list.payload()
+	if err != nil {
+		return err
+	}
+	list.Signature = base64.StdEncoding.EncodeToString(ed25519.Sign(key, payload))
+	return nil
+}
+
+// verify the version and the signature of the blocklist, which must be
+// signed by one of the trusted public keys
+func (list *Blocklist) verify(trusted []string) error {
+	if list.Version < 1 || list.Version > blocklistVersion {
+		return fmt.Errorf("unsupported blocklist version %v", list.Version)
+	}
+	key, err := base64.StdEncoding.DecodeString(list.PublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errBlocklistSignature
+	}
+	signature, err := base64.StdEncoding.DecodeString(list.Signature)
+	if err != nil {
+		return errBlocklistSignature
+	}
+	payload, err := list.payload()
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), payload, signature) {
+		return errBlocklistSignature
+	}
+	if !contains(trusted, list.PublicKey) {
+		return errBlocklistUntrusted
+	}
+	return nil
+}
+
+// exportBlocklist return the offenders removed and the troll groups known
+// by this instance, with the imported ones, signed with the key
+func exportBlocklist(key ed25519.PrivateKey) (*Blocklist, error) {
+	issuer := blocklistIssuer()
+	users, groups := store.blocklist(issuer)
+	for _, group := range trollGroups {
+		known := false
+		for i := range groups {
+			if strings.EqualFold(groups[i].Group, group) {
+				groups[i].Sources = merge(groups[i].Sources, issuer)
+				known = true
+			}
+		}
+		if !known {
+			groups = append(groups, BlockedGroup{Group: group, Sources: []string{issuer}})
+		}
+	}
+	list := &Blocklist{
+		Version: blocklistVersion,
+		Issuer:  issuer,
+		Created: time.Now().UTC(),
+		Users:   users,
+		Groups:  groups,
+	}
+	if err := list.sign(key); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+// parseBlocklist decode and verify the encoded blocklist
+func parseBlocklist(data []byte) (*Blocklist, error) {
+	var list Blocklist
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	if err := list.verify(config.BlocklistTrusted); err != nil {
+		return nil, err
+	}
+	for _, group := range list.Groups {
+		if !strings.HasPrefix(group.Group, "@") {
+			return nil, fmt.Errorf("invalid blocklist group %q", group.Group)
+		}
+	}
+	return &list, nil
+}
+
+// importBlocklist verify the encoded blocklist and merge it into the
+// store. Return the blocklist with how many users and groups were new.
+func importBlocklist(data []byte) (*Blocklist, int, int, error) {
+	list, err := parseBlocklist(data)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	users, groups := store.mergeBlocklist(list)
+	return list, users, groups, nil
+}
+
+// queueBlocklist append the blocklist to the queue in fpath, leaving the
+// store to the running bot, which would overwrite it
+func queueBlocklist(fpath string, list *Blocklist) error {
+	var queue []*Blocklist
+	data, err := ioutil.ReadFile(fpath)
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &queue); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+	data, err = json.Marshal(append(queue, list))
+	if err != nil {
+		return err
+	}
+	return writeFile(fpath, data)
+}
+
+// mergeBlocklistQueue merge the blocklists queued in fpath into the
+// store. The queue is moved away first, so the blocklists queued
+// meanwhile are kept for the next time.
+func mergeBlocklistQueue(fpath string) {
+	merging := fpath + ".merging"
+	if err := os.Rename(fpath, merging); err != nil && !os.IsNotExist(err) {
+		log.Printf("[!] Moving %q failed: %v", fpath, err)
+		return
+	}
+	data, err := ioutil.ReadFile(merging)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Reading %q failed: %v", merging, err)
+		}
+		return
+	}
+	var queue []*Blocklist
+	if err := json.Unmarshal(data, &queue); err != nil {
+		log.Printf("Parsing %q go bad, got error: %v", merging, err)
+		return
+	}
+	for _, list := range queue {
+		users, groups := store.mergeBlocklist(list)
+		log.Printf("Imported the blocklist of %v: %v new users and %v new groups", list.Issuer, users, groups)
+	}
+	if err := os.Remove(merging); err != nil {
+		log.Printf("[!] Removing %q failed: %v", merging, err)
+	}
+}
+
+// blocklistCommand run the blocklist subcommands of the command line:
+// - blocklist export [file]: write the signed blocklist to the file, or out
+// - blocklist import <file|URL>: queue the blocklist to be merged by the
+// bot on its next refresh of the ban lists
+func blocklistCommand(args []string, out io.Writer) error {
+	usage := errors.New("usage: troll-shield blocklist export [file] | import <file|URL>")
+	if len(args) == 0 {
+		return usage
+	}
+	switch {
+	case args[0] == "export" && len(args) <= 2:
+		key, err := signingKey()
+		if err != nil {
+			return err
+		}
+		list, err := exportBlocklist(key)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(list, "", "  ")
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+		if len(args) == 2 {
+			return ioutil.WriteFile(args[1], data, 0666)
+		}
+		_, err = out.Write(data)
+		return err
+	case args[0] == "import" && len(args) == 2:
+		data, err := readBanList(args[1])
+		if err != nil {
+			return err
+		}
+		list, err := parseBlocklist(data)
+		if err != nil {
+			return err
+		}
+		if err := queueBlocklist(blocklistQueueFile, list); err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(out, "Queued the blocklist of %v: %v users and %v groups\n", list.Issuer, len(list.Users), len(list.Groups))
+		return err
+	}
+	return usage
+}
+
+// importList merge the blocklist uploaded by an admin, parse:
+// - /importlist as the caption of the file
+// - /importlist replying the file
+func importList(bot TrollShieldBot, update *telegram.Update) {
+	msg := update.Message
+	document := msg.Document
+	if document == nil && msg.ReplyToMessage != nil {
+		document = msg.ReplyToMessage.Document
+	}
+	if document == nil {
+		replyMessage(bot, update, "import_usage", nil)
+		return
+	}
+	// the link has the token of the bot, keep it out of the errors
+	link, err := bot.GetFileDirectURL(document.FileID)
+	var data []byte
+	if err == nil {
+		data, err = download(link)
+	}
+	var list *Blocklist
+	users, groups := 0, 0
+	if err == nil {
+		list, users, groups, err = importBlocklist(data)
+	}
+	if err != nil {
+		log.Printf("[!] Importing the blocklist %v failed: %v", document.FileName, hideURL(err))
+		replyMessage(bot, update, "import_failed", nil)
+		return
+	}
+	auditLog(bot, AuditEntry{
+		ChatID: msg.Chat.ID,
+		Action: "import-blocklist",
+		Reason: fmt.Sprintf("%v: %v users, %v groups", list.Issuer, users, groups),
+		Actor:  commandActor(update),
+	})
+	replyMessage(bot, update, "importlist", vars{"Issuer": list.Issuer, "Users": users, "Groups": groups})
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// signedBlocklist return the encoded blocklist signed with a new key,
+// with the public key of it
+func signedBlocklist(t *testing.T, list Blocklist) ([]byte, string) {
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := list.sign(key); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data, list.PublicKey
+}
+
+func TestBlocklistVerify(t *testing.T) {
+	list := Blocklist{Version: blocklistVersion, Issuer: "lisp", Users: []BlockedUser{{ID: 1}}}
+	data, key := signedBlocklist(t, list)
+	if err := json.Unmarshal(data, &list); err != nil {
+		t.Fatal(err)
+	}
+	if err := list.verify([]string{key}); err != nil {
+		t.Errorf("verify should accept the signed blocklist, got %v", err)
+	}
+	if err := list.verify(nil); err != errBlocklistUntrusted {
+		t.Errorf("verify should reject untrusted keys, got %v", err)
+	}
+
+	tampered := list
+	tampered.Users = []BlockedUser{{ID: 2}}
+	if err := tampered.verify([]string{key}); err != errBlocklistSignature {
+		t.Errorf("verify should reject tampered blocklists, got %v", err)
+	}
+	future := list
+	future.Version = blocklistVersion + 1
+	if err := future.verify([]string{key}); err == nil {
+		t.Errorf("verify should reject unknown versions")
+	}
+}
+
+func TestImportBlocklist(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+	store.addOffence(telegram.User{ID: 1, UserName: "troll"}, "@mlbrasil", actionBan)
+	store.addOffence(telegram.User{ID: 3}, "flood", actionRestrict)
+
+	data, key := signedBlocklist(t, Blocklist{
+		Version: blocklistVersion,
+		Issuer:  "lisp",
+		Users: []BlockedUser{
+			{ID: 1, Reasons: []string{"spam"}, Sources: []string{"haskell"}},
+			{ID: 2, Name: "spammer", Reasons: []string{"spam"}},
+		},
+		Groups: []BlockedGroup{{Group: "@Trolleira"}, {Group: "@mlbrasil"}},
+	})
+	config = &Config{BlocklistTrusted: []string{key}, BlocklistIssuer: "commonlispbr"}
+	list, users, groups, err := importBlocklist(data)
+	if err != nil {
+		t.Fatalf("importBlocklist failed: %v", err)
+	}
+	if list.Issuer != "lisp" || users != 2 || groups != 2 {
+		t.Errorf("importBlocklist expected 2 users and 2 groups of lisp, got %v %v %v", list.Issuer, users, groups)
+	}
+	if _, users, groups, _ := importBlocklist(data); users != 0 || groups != 0 {
+		t.Errorf("importBlocklist should deduplicate, got %v users and %v groups", users, groups)
+	}
+	if got := store.bannedBy(1); got != "haskell, lisp" {
+		t.Errorf("importBlocklist should keep the provenance, got %q", got)
+	}
+	if houses := trollHouses(); houses[len(houses)-1] != "@trolleira" || len(houses) != len(trollGroups)+1 {
+		t.Errorf("trollHouses should include the imported groups once, got %v", houses)
+	}
+
+	exported, err := exportBlocklist(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize)))
+	if err != nil {
+		t.Fatalf("exportBlocklist failed: %v", err)
+	}
+	if len(exported.Users) != 2 {
+		t.Fatalf("exportBlocklist expected 2 users, without the restricted, got %+v", exported.Users)
+	}
+	first := exported.Users[0]
+	if strings.Join(first.Sources, ",") != "haskell,lisp,commonlispbr" || strings.Join(first.Reasons, ",") != "spam,@mlbrasil" {
+		t.Errorf("exportBlocklist should merge the offenders, got %+v", first)
+	}
+	if err := exported.verify([]string{exported.PublicKey}); err != nil {
+		t.Errorf("exportBlocklist should sign the blocklist, got %v", err)
+	}
+
+	store.exempt(telegram.User{ID: 2})
+	if exported, _ := exportBlocklist(ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))); len(exported.Users) != 1 {
+		t.Errorf("exportBlocklist should skip the exempted users, got %+v", exported.Users)
+	}
+
+	bad, key := signedBlocklist(t, Blocklist{Version: blocklistVersion, Groups: []BlockedGroup{{Group: "-100"}}})
+	config.BlocklistTrusted = []string{key}
+	if _, _, _, err := importBlocklist(bad); err == nil {
+		t.Errorf("importBlocklist should reject groups without @")
+	}
+}
+
+func TestBlocklistCommand(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	dir, err := ioutil.TempDir("", "troll-shield")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	config = &Config{BlocklistKey: filepath.Join(dir, "blocklist.key")}
+	store = newStore("")
+	store.addOffence(telegram.User{ID: 1}, "@mlbrasil", actionKick)
+
+	listFile := filepath.Join(dir, "blocklist.json")
+	if err := blocklistCommand([]string{"export", listFile}, ioutil.Discard); err != nil {
+		t.Fatalf("blocklist export failed: %v", err)
+	}
+	key, err := loadSigningKey(config.BlocklistKey)
+	if err != nil {
+		t.Fatalf("blocklist export should save the key: %v", err)
+	}
+
+	store = newStore("")
+	var out bytes.Buffer
+	if err := blocklistCommand([]string{"import", listFile}, &out); err != errBlocklistUntrusted {
+		t.Errorf("blocklist import should reject untrusted keys, got %v", err)
+	}
+	config.BlocklistTrusted = []string{base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey))}
+	for i := 0; i < 2; i++ {
+		if err := blocklistCommand([]string{"import", listFile}, &out); err != nil {
+			t.Fatalf("blocklist import failed: %v", err)
+		}
+	}
+	if got := out.String(); !strings.HasPrefix(got, "Queued the blocklist of troll-shield: 1 users and 5 groups\n") {
+		t.Errorf("blocklist import expected the summary, got %q", got)
+	}
+	if got := store.bannedBy(1); got != "" {
+		t.Errorf("blocklist import should leave the store to the bot, got %q", got)
+	}
+
+	mergeBlocklistQueue(blocklistQueueFile)
+	if got := store.bannedBy(1); got != "troll-shield" {
+		t.Errorf("mergeBlocklistQueue should merge the queued blocklists, got %q", got)
+	}
+	if _, err := os.Stat(blocklistQueueFile); !os.IsNotExist(err) {
+		t.Errorf("mergeBlocklistQueue should empty the queue, got %v", err)
+	}
+	if _, err := os.Stat(blocklistQueueFile + ".merging"); !os.IsNotExist(err) {
+		t.Errorf("mergeBlocklistQueue should remove the merged queue, got %v", err)
+	}
+	if err := blocklistCommand([]string{"merge"}, &out); err == nil || !strings.HasPrefix(err.Error(), "usage:") {
+		t.Errorf("blocklist should fail with the usage, got %v", err)
+	}
+}
+
+func TestImportList(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+	data, key := signedBlocklist(t, Blocklist{Version: blocklistVersion, Issuer: "lisp", Users: []BlockedUser{{ID: 7}}})
+	config = &Config{BlocklistTrusted: []string{key}}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(data)
+	}))
+	defer server.Close()
+	bot := SentMockup{}
+	update := telegram.Update{Message: &telegram.Message{
+		Text: "/importlist",
+		Chat: &telegram.Chat{ID: -1},
+		From: &telegram.User{UserName: "lerax"},
+	}}
+
+	importList(&bot, &update)
+	if got := bot.lastText(); !strings.HasPrefix(got, "Uso: /importlist") {
+		t.Errorf("importList should reply the usage, got %q", got)
+	}
+
+	update.Message.ReplyToMessage = &telegram.Message{Document: &telegram.Document{FileID: server.URL}}
+	importList(&bot, &update)
+	if got := bot.lastText(); got != "A lista de bloqueio de lisp foi importada: 1 usuários e 0 grupos novos." {
+		t.Errorf("importList should import the replied file, got %q", got)
+	}
+	if got := store.bannedBy(7); got != "lisp" {
+		t.Errorf("importList should merge the blocklist, got %q", got)
+	}
+
+	config.BlocklistTrusted = nil
+	update.Message.Document = update.Message.ReplyToMessage.Document
+	update.Message.ReplyToMessage = nil
+	importList(&bot, &update)
+	if got := bot.lastText(); !strings.HasPrefix(got, "Não consegui importar a lista de bloqueio") {
+		t.Errorf("importList should reply the failure, got %q", got)
+	}
+}
+
+func TestDownloadHidesURL(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	for _, link := range []string{server.URL + "/file/botSECRET/list.json", "http://127.0.0.1:0/file/botSECRET/list.json"} {
+		if _, err := download(link); err == nil || strings.Contains(err.Error(), "SECRET") {
+			t.Errorf("download(%q) should fail without the URL, got %v", link, err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const captchaPrefix = "captcha:"
+
+var defaultCaptchaTimeout = 2 * time.Minute
+
+// captchaMargin is how long the captcha restriction outlasts the timeout
+const captchaMargin = time.Minute
+
+// challenge is an arithmetic question waiting the newcomer answer
+type challenge struct {
+	chatID    int64
+	chatTitle string
+	user      telegram.User
+	answer    int
+	messageID int
+	timer     *time.Timer
+	// shadow is kept from the time of the challenge, the timeout runs in another goroutine
+	shadow bool
+}
+
+// challenges waiting an answer, keyed by challengeKey
+var challenges = struct {
+	sync.Mutex
+	m map[string]*challenge
+}{m: make(map[string]*challenge)}
+
+var captchaRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+func challengeKey(chatID int64, userID int) string {
+	return fmt.Sprintf("%d:%d", chatID, userID)
+}
+
+// takeChallenge remove and return the challenge, stopping its timeout,
+// so only one of the answer or the timeout resolves it
+func takeChallenge(key string) *challenge {
+	challenges.Lock()
+	defer challenges.Unlock()
+	c, ok := challenges.m[key]
+	if !ok {
+		return nil
+	}
+	delete(challenges.m, key)
+	c.timer.Stop()
+	return c
+}
+
+// captchaTimeout return how long the newcomer has to answer in that chat
+func captchaTimeout(chatID int64) time.Duration {
+	if timeout := settingsFor(chatID).CaptchaTimeout; timeout > 0 {
+		return time.Duration(timeout)
+	}
+	return defaultCaptchaTimeout
+}
+
+// captchaQuestion return two operands and the shuffled options
+// with the right answer and three wrong ones
+func captchaQuestion() (int, int, []int) {
+	a, b := captchaRand.Intn(9)+1, captchaRand.Intn(9)+1
+	options := []int{a + b}
+	for len(options) < 4 {
+		option := captchaRand.Intn(17) + 2
+		duplicated := false
+		for _, o := range options {
+			duplicated = duplicated || o == option
+		}
+		if !duplicated {
+			options = append(options, option)
+		}
+	}
+	captchaRand.Shuffle(len(options), func(i, j int) {
+		options[i], options[j] = options[j], options[i]
+	})
+	return a, b, options
+}
+
+// setSendPermissions restrict or lift the restriction of a chat member
+func setSendPermissions(bot TrollShieldBot, chatMember telegram.ChatMemberConfig, allowed bool) (telegram.APIResponse, error) {
+	return bot.RestrictChatMember(telegram.RestrictChatMemberConfig{
+		ChatMemberConfig:      chatMember,
+		CanSendMessages:       &allowed,
+		CanSendMediaMessages:  &allowed,
+		CanSendOtherMessages:  &allowed,
+		CanAddWebPagePreviews: &allowed,
+	})
+}
+
+// deleteMessage delete a message logging when it fails
+func deleteMessage(bot TrollShieldBot, chatID int64, messageID int) {
+	resp, err := bot.DeleteMessage(telegram.NewDeleteMessage(chatID, messageID))
+	if !resp.Ok || err != nil {
+		log.Printf("[!] Deleting message %v from %v failed: %v", messageID, chatID, err)
+	}
+}
+
+// deleteReplied delete the message of the update, which must be done
+// only after replying it: the replies fail once it's deleted.
+func deleteReplied(bot TrollShieldBot, update *telegram.Update) {
+	deleteMessage(bot, update.Message.Chat.ID, update.Message.MessageID)
+}
+
+// challengeMember restrict the newcomer until the right answer of an
+// arithmetic question is chosen, kicking the newcomer on timeout. The
+// restriction expires by itself a bit after the timeout, in case the
+// bot restarts before that.
+func challengeMember(bot TrollShieldBot, update *telegram.Update, member telegram.User) {
+	chatID := update.Message.Chat.ID
+	timeout := captchaTimeout(chatID)
+	shadow := shadowMode(chatID)
+	if shadow {
+		log.Printf("[shadow] %v would be restricted for captcha", member.ID)
+	} else {
+		denied := false
+		resp, err := bot.RestrictChatMember(telegram.RestrictChatMemberConfig{
+			ChatMemberConfig:      telegram.ChatMemberConfig{ChatID: chatID, UserID: member.ID},
+			UntilDate:             untilDate(Duration(timeout + captchaMargin)),
+			CanSendMessages:       &denied,
+			CanSendMediaMessages:  &denied,
+			CanSendOtherMessages:  &denied,
+			CanAddWebPagePreviews: &denied,
+		})
+		if !resp.Ok || err != nil {
+			log.Printf("[!] Restricting %v for captcha failed: %v", member.ID, err)
+			return
+		}
+	}
+
+	a, b, options := captchaQuestion()
+	buttons := make([]telegram.InlineKeyboardButton, len(options))
+	for i, option := range options {
+		data := fmt.Sprintf("%s%d:%d", captchaPrefix, member.ID, option)
+		buttons[i] = telegram.NewInlineKeyboardButtonData(strconv.Itoa(option), data)
+	}
+	locale := chatLocale(chatID)
+	msg := telegram.NewMessage(chatID, string(chatFormat(chatID, "captcha", vars{
+		"User":    member,
+		"Timeout": formatDuration(locale, Duration(timeout)),
+		"A":       a,
+		"B":       b,
+	})))
+	msg.ParseMode = chatMode(chatID)
+	msg.ReplyToMessageID = update.Message.MessageID
+	msg.ReplyMarkup = telegram.NewInlineKeyboardMarkup(buttons)
+	sent, err := bot.Send(msg)
+	if err != nil {
+		log.Printf("[!] Send captcha failed: %v", err)
+	}
+
+	key := challengeKey(chatID, member.ID)
+	c := &challenge{
+		chatID:    chatID,
+		chatTitle: update.Message.Chat.Title,
+		user:      member,
+		answer:    a + b,
+		messageID: sent.MessageID,
+		shadow:    shadow,
+	}
+	challenges.Lock()
+	challenges.m[key] = c
+	c.timer = time.AfterFunc(timeout, func() {
+		if c := takeChallenge(key); c != nil {
+			failChallenge(bot, c, "timeout")
+		}
+	})
+	challenges.Unlock()
+}
+
+// passChallenge lift the restriction of the newcomer, which was not set
+// in shadow mode
+func passChallenge(bot TrollShieldBot, c *challenge) {
+	deleteMessage(bot, c.chatID, c.messageID)
+	if !c.shadow {
+		chatMember := telegram.ChatMemberConfig{ChatID: c.chatID, UserID: c.user.ID}
+		if resp, err := setSendPermissions(bot, chatMember, true); !resp.Ok || err != nil {
+			log.Printf("[!] Lifting restriction of %v failed: %v", c.user.ID, err)
+		}
+		restrictProbation(bot, c.chatID, c.user)
+	}
+	auditLog(bot, AuditEntry{
+		ChatID:   c.chatID,
+		UserID:   c.user.ID,
+		UserName: getUserName(c.user),
+		Action:   "captcha-pass",
+	})
+	if settingsFor(c.chatID).GreetAll {
+		update := chatUpdate(c.chatID)
+		update.Message.Chat.Title = c.chatTitle
+		welcomeMessage(bot, update, c.user)
+	}
+}
+
+// failChallenge kick the newcomer, who can join and try again later
+func failChallenge(bot TrollShieldBot, c *challenge, reason string) {
+	deleteMessage(bot, c.chatID, c.messageID)
+	entry := AuditEntry{
+		ChatID:   c.chatID,
+		UserID:   c.user.ID,
+		UserName: getUserName(c.user),
+		Action:   "captcha-" + actionKick,
+		Reason:   reason,
+	}
+	if c.shadow {
+		log.Printf("[shadow] %v would be kicked for captcha %v", entry.UserName, reason)
+		entry.Action = "shadow-" + entry.Action
+		auditLog(bot, entry)
+		return
+	}
+	chatMember := telegram.ChatMemberConfig{ChatID: c.chatID, UserID: c.user.ID}
+	if resp, err := applyPolicy(bot, chatMember, KickPolicy{Action: actionKick}); !resp.Ok || err != nil {
+		log.Printf("[!] Kicking %v for captcha %v failed: %v", c.user.ID, reason, err)
+		return
+	}
+	auditLog(bot, entry)
+}
+
+// captchaCallback handle the button pressed on a captcha challenge
+func captchaCallback(bot TrollShieldBot, query *telegram.CallbackQuery) {
+	var userID, option int
+	data := strings.TrimPrefix(query.Data, captchaPrefix)
+	if _, err := fmt.Sscanf(data, "%d:%d", &userID, &option); err != nil || query.Message == nil {
+		return
+	}
+
+	id := "captcha_other"
+	if query.From.ID == userID {
+		switch c := takeChallenge(challengeKey(query.Message.Chat.ID, userID)); {
+		case c == nil:
+			id = "captcha_expired"
+		case c.answer == option:
+			passChallenge(bot, c)
+			id = "captcha_right"
+		default:
+			failChallenge(bot, c, "wrong answer")
+			id = "captcha_wrong"
+		}
+	}
+	text := tr(chatLocale(query.Message.Chat.ID), id, nil)
+
+	if _, err := bot.AnswerCallbackQuery(telegram.NewCallback(query.ID, text)); err != nil {
+		log.Printf("[!] Answer callback failed: %v", err)
+	}
+}
+
+// callbackQueryEvent return true if a inline keyboard button was pressed
+func callbackQueryEvent(update *telegram.Update) bool {
+	return update.CallbackQuery != nil
+}
+
+// captchaEvent return true if a captcha button was pressed
+func captchaEvent(update *telegram.Update) bool {
+	return callbackQueryEvent(update) && strings.HasPrefix(update.CallbackQuery.Data, captchaPrefix)
+}
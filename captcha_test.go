@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestCaptchaQuestion(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		a, b, options := captchaQuestion()
+		if len(options) != 4 {
+			t.Fatalf("captchaQuestion should return 4 options, got %v", options)
+		}
+		found := 0
+		for _, option := range options {
+			if option == a+b {
+				found++
+			}
+		}
+		if found != 1 {
+			t.Fatalf("captchaQuestion should have the answer %v once, got %v", a+b, options)
+		}
+	}
+}
+
+func TestCaptchaTimeout(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"chats": {"1": {"captcha": true, "captcha_timeout": "30s"}}}`))
+	if got := captchaTimeout(1); got != 30*time.Second {
+		t.Errorf("captchaTimeout of chat 1 should be 30s, got %v", got)
+	}
+	if got := captchaTimeout(2); got != defaultCaptchaTimeout {
+		t.Errorf("captchaTimeout of chat 2 should be the default, got %v", got)
+	}
+}
+
+func newCaptchaUpdate() telegram.Update {
+	return telegram.Update{Message: &telegram.Message{Chat: &telegram.Chat{ID: 1}}}
+}
+
+// cleanupChallenge remove the challenge when the test ends, so its
+// timeout doesn't fire on the next tests
+func cleanupChallenge(t *testing.T, chatID int64, userID int) {
+	t.Cleanup(func() { takeChallenge(challengeKey(chatID, userID)) })
+}
+
+func TestCaptchaCallback(t *testing.T) {
+	bot := BotMockup{}
+	update := newCaptchaUpdate()
+	member := telegram.User{ID: 0}
+	cleanupChallenge(t, 1, 0)
+	challengeMember(&bot, &update, member)
+
+	key := challengeKey(1, 0)
+	challenges.Lock()
+	c := challenges.m[key]
+	challenges.Unlock()
+	if c == nil {
+		t.Fatalf("challengeMember should register a challenge")
+	}
+
+	query := telegram.CallbackQuery{
+		From:    &telegram.User{ID: 5},
+		Message: update.Message,
+		Data:    fmt.Sprintf("%s0:%d", captchaPrefix, c.answer),
+	}
+	if !captchaEvent(&telegram.Update{CallbackQuery: &query}) {
+		t.Errorf("captchaEvent should be true for captcha callbacks")
+	}
+	captchaCallback(&bot, &query)
+	if takeChallenge(key) != c {
+		t.Fatalf("challenge should not be answered by another user")
+	}
+	challenges.Lock()
+	challenges.m[key] = c
+	challenges.Unlock()
+
+	query.From.ID = 0
+	captchaCallback(&bot, &query)
+	if takeChallenge(key) != nil {
+		t.Errorf("challenge should be resolved by the right answer")
+	}
+
+	// answering again after the challenge was resolved
+	captchaCallback(&bot, &query)
+}
+
+func TestCaptchaWrongAnswerAndTimeout(t *testing.T) {
+	defer func(d time.Duration) { defaultCaptchaTimeout = d }(defaultCaptchaTimeout)
+	defer func(f string) { auditFile = f }(auditFile)
+	tmpfile, err := ioutil.TempFile("", "audit.jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+	auditFile = tmpfile.Name()
+	defaultCaptchaTimeout = 10 * time.Millisecond
+	bot := BotMockup{}
+	update := newCaptchaUpdate()
+	cleanupChallenge(t, 1, 0)
+	cleanupChallenge(t, 1, 1)
+	challengeMember(&bot, &update, telegram.User{ID: 0})
+
+	key := challengeKey(1, 0)
+	challenges.Lock()
+	c := challenges.m[key]
+	challenges.Unlock()
+	query := telegram.CallbackQuery{
+		From:    &telegram.User{ID: 0},
+		Message: update.Message,
+		Data:    fmt.Sprintf("%s0:%d", captchaPrefix, c.answer+1),
+	}
+	captchaCallback(&bot, &query)
+	if takeChallenge(key) != nil {
+		t.Errorf("challenge should be resolved by a wrong answer")
+	}
+
+	if err := ioutil.WriteFile(auditFile, nil, 0666); err != nil {
+		t.Fatal(err)
+	}
+	challengeMember(&bot, &update, telegram.User{ID: 0})
+	// the timeout is done with the globals once its kick is audited
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		auditMutex.Lock()
+		data, err := ioutil.ReadFile(auditFile)
+		auditMutex.Unlock()
+		if err == nil && len(data) > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("challenge should be resolved by the timeout")
+		}
+	}
+	if takeChallenge(key) != nil {
+		t.Errorf("challenge should be resolved by the timeout")
+	}
+
+	// the mockup can't restrict other users than 0
+	challengeMember(&bot, &update, telegram.User{ID: 1})
+	if takeChallenge(challengeKey(1, 1)) != nil {
+		t.Errorf("challenge should not be registered when restriction fails")
+	}
+}
+
+// RestrictMockup records the restrictions
+type RestrictMockup struct {
+	BotMockup
+	restricted []telegram.RestrictChatMemberConfig
+}
+
+func (bot *RestrictMockup) RestrictChatMember(c telegram.RestrictChatMemberConfig) (telegram.APIResponse, error) {
+	bot.restricted = append(bot.restricted, c)
+	return bot.BotMockup.RestrictChatMember(c)
+}
+
+func TestCaptchaRestriction(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"chats": {"1": {"captcha_timeout": "1h"}}}`))
+	bot := RestrictMockup{}
+	update := newCaptchaUpdate()
+	cleanupChallenge(t, 1, 0)
+	cleanupChallenge(t, 1, 1)
+	challengeMember(&bot, &update, telegram.User{ID: 0})
+	takeChallenge(challengeKey(1, 0))
+	if len(bot.restricted) != 1 {
+		t.Fatalf("challengeMember should restrict the newcomer, got %+v", bot.restricted)
+	}
+	until := time.Unix(bot.restricted[0].UntilDate, 0)
+	if expected := time.Now().Add(time.Hour + captchaMargin); until.Before(expected.Add(-time.Minute)) || until.After(expected) {
+		t.Errorf("captcha restriction should expire after the timeout, got %v", until)
+	}
+
+	config, _ = parseConfig([]byte(`{"chats": {"1": {"shadow": true, "captcha_timeout": "1h"}}}`))
+	bot.restricted = nil
+	challengeMember(&bot, &update, telegram.User{ID: 1})
+	if len(bot.restricted) != 0 {
+		t.Errorf("challengeMember should not restrict in shadow mode, got %+v", bot.restricted)
+	}
+	challenges.Lock()
+	c := challenges.m[challengeKey(1, 1)]
+	challenges.Unlock()
+	if c == nil {
+		t.Fatalf("challengeMember should challenge in shadow mode")
+	}
+	captchaCallback(&bot, &telegram.CallbackQuery{
+		From:    &telegram.User{ID: 1},
+		Message: update.Message,
+		Data:    fmt.Sprintf("%s1:%d", captchaPrefix, c.answer),
+	})
+	if len(bot.restricted) != 0 {
+		t.Errorf("passing the captcha should not lift the restriction in shadow mode, got %+v", bot.restricted)
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"context"
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// describeStatus return the membership in the locale and parse mode
+func describeStatus(mode string, locale string, status TrollHouseStatus) formatted {
+	data := vars{"Group": status.Group, "Status": status.Status}
+	switch {
+	case status.Err != nil:
+		data["Error"] = status.Err
+		return format(mode, locale, "check_error", data)
+	case status.IsMember():
+		return format(mode, locale, "check_member", data)
+	}
+	return format(mode, locale, "check_left", data)
+}
+
+// checkUser reply the membership of the user in each troll group,
+// without taking any action. Parse:
+// - /check <@username|ID>
+// - /check replying a message
+func checkUser(bot TrollShieldBot, botHidden TrollShieldBot, update *telegram.Update) {
+	user, ok := resolveTarget(update)
+	if !ok {
+		replyMessage(bot, update, "target_usage", vars{"Command": "/check"})
+		return
+	}
+
+	chatID := update.Message.Chat.ID
+	mode, locale := chatMode(chatID), chatLocale(chatID)
+	lines := []string{string(format(mode, locale, "check", vars{"User": user, "ID": user.ID}))}
+	statuses := trollHouseStatus(context.Background(), botHidden, user.ID)
+	for _, status := range statuses {
+		lines = append(lines, string(describeStatus(mode, locale, status)))
+	}
+	if risk := settingsFor(chatID).Risk; risk.enabled() {
+		// the troll houses are already known, without the audit of the check
+		known := map[string]Verdict{riskTrollHouses: membershipVerdict(statuses)}
+		verdicts := detectWith(bot, botHidden, update, user, known)
+		total, signals := assessRisk(verdicts, &risk)
+		action := format(mode, locale, "risk_"+riskDecision(&risk, total, flagged(verdicts)), nil)
+		lines = append(lines, string(format(mode, locale, "check_risk", vars{"Score": total, "Action": action})))
+		for _, signal := range signals {
+			lines = append(lines, string(format(mode, locale, "check_signal", vars{
+				"Name":     signal.Name,
+				"Score":    signal.Score,
+				"Evidence": signal.Evidence,
+			})))
+		}
+	}
+	if source := store.bannedBy(user.ID); source != "" {
+		lines = append(lines, string(format(mode, locale, "check_banned", vars{"List": source})))
+	}
+	if store.trusted(user.ID) {
+		lines = append(lines, string(format(mode, locale, "check_trusted", nil)))
+	}
+	if store.exempted(user.ID) {
+		lines = append(lines, string(format(mode, locale, "check_exempt", nil)))
+	}
+	if offences := store.offences(user.ID); offences > 0 {
+		lines = append(lines, string(format(mode, locale, "check_offences", vars{"Offences": offences})))
+	}
+	reply(bot, update, formatted(strings.Join(lines, "\n")))
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestDescribeStatus(t *testing.T) {
+	tableTest := []struct {
+		status   TrollHouseStatus
+		expected string
+	}{
+		{TrollHouseStatus{Group: "@g", Status: "member"}, "@g: membro (member)"},
+		{TrollHouseStatus{Group: "@g", Status: "creator"}, "@g: membro (creator)"},
+		{TrollHouseStatus{Group: "@g", Status: "left"}, "@g: não é membro (left)"},
+		{TrollHouseStatus{Group: "@g"}, "@g: não é membro"},
+		{TrollHouseStatus{Group: "@g", Err: errors.New("user not found")}, "@g: erro: user not found"},
+	}
+	for _, test := range tableTest {
+		if got := describeStatus(modePlain, "pt", test.status); string(got) != test.expected {
+			t.Errorf("describeStatus(%+v): expected %q, got %q", test.status, test.expected, got)
+		}
+	}
+}
+
+func TestCheckUser(t *testing.T) {
+	defer func(g []string) { trollGroups = g }(trollGroups)
+	trollGroups = []string{"@rolisvaldo", "@trolleira"}
+	bot := SentMockup{}
+	update := telegram.Update{Message: &telegram.Message{
+		Text: "/check 1",
+		Chat: &telegram.Chat{},
+	}}
+
+	checkUser(&bot, &bot, &update)
+	expected := "Verificação de <a href=\"tg://user?id=1\">1</a> (1):\n@rolisvaldo: membro (member)\n@trolleira: membro (member)"
+	if got := bot.lastText(); got != expected {
+		t.Errorf("checkUser expected %q, got %q", expected, got)
+	}
+
+	update.Message.Text = "/check 99"
+	checkUser(&bot, &bot, &update)
+	if got := bot.lastText(); !strings.Contains(got, "@trolleira: erro: user not found") {
+		t.Errorf("checkUser should report lookup errors, got %q", got)
+	}
+
+	update.Message.Text = "/check"
+	checkUser(&bot, &bot, &update)
+	if got := bot.lastText(); !strings.HasPrefix(got, "Uso: /check") {
+		t.Errorf("checkUser should reply the usage, got %q", got)
+	}
+}
+
+// LeakMockup fails the lookups like the http client, with the URL
+type LeakMockup struct {
+	SentMockup
+}
+
+func (bot *LeakMockup) GetChatMember(c telegram.ChatConfigWithUser) (telegram.ChatMember, error) {
+	return telegram.ChatMember{}, &url.Error{Op: "Post", URL: "https://api.telegram.org/botSECRET/getChatMember", Err: errors.New("timeout")}
+}
+
+func TestCheckUserHidesURL(t *testing.T) {
+	bot := LeakMockup{}
+	update := telegram.Update{Message: &telegram.Message{
+		Text: "/check 1",
+		Chat: &telegram.Chat{},
+	}}
+	checkUser(&bot, &bot, &update)
+	if got := bot.lastText(); strings.Contains(got, "SECRET") || !strings.Contains(got, "timeout") {
+		t.Errorf("checkUser should report the errors without the URL, got %q", got)
+	}
+}
@@ -0,0 +1,279 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration read from strings like "90s", "12h", "7d" or "2w"
+type Duration time.Duration
+
+// parseDuration extends time.ParseDuration with days (d) and weeks (w),
+// rejecting negative durations
+func parseDuration(s string) (time.Duration, error) {
+	units := map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+	for suffix, unit := range units {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.Atoi(strings.TrimSuffix(s, suffix))
+			if err != nil {
+				return 0, fmt.Errorf("invalid duration %q", s)
+			}
+			if n < 0 {
+				return 0, fmt.Errorf("negative duration %q", s)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d < 0 {
+		return 0, fmt.Errorf("negative duration %q", s)
+	}
+	return d, err
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := parseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ChatSettings are the options that can be tuned for each chat
+type ChatSettings struct {
+	// Shadow only logs and notifies what the bot would have done,
+	// overriding the global Shadow when set
+	Shadow *bool `json:"shadow,omitempty"`
+	// Locale of the messages, "pt" (default) or "en"
+	Locale string `json:"locale"`
+	// Policy is applied to trolls, unless a group in GroupPolicies matches
+	Policy        KickPolicy            `json:"policy"`
+	GroupPolicies map[string]KickPolicy `json:"group_policies"`
+	// Ladder replaces Policy with one step for each repeated offence
+	Ladder []KickPolicy `json:"ladder"`
+	// Captcha challenges the newcomers, which are kicked after CaptchaTimeout
+	Captcha        bool     `json:"captcha"`
+	CaptchaTimeout Duration `json:"captcha_timeout"`
+	// FloodMessages is how many messages an user can send, and
+	// FloodRepeats how many identical ones, within FloodInterval.
+	// Flooders are muted for FloodMute, until the FloodStrikes
+	// mute, when the kick policy is applied instead. The strikes are
+	// forgotten after FloodStrikeExpiry without floods.
+	FloodMessages     int      `json:"flood_messages"`
+	FloodRepeats      int      `json:"flood_repeats"`
+	FloodInterval     Duration `json:"flood_interval"`
+	FloodMute         Duration `json:"flood_mute"`
+	FloodStrikes      int      `json:"flood_strikes"`
+	FloodStrikeExpiry Duration `json:"flood_strike_expiry"`
+	// RaidJoins is how many joins within RaidInterval put the chat in
+	// lockdown, restricting the joiners for RaidMute and, with
+	// RaidLockChat, making the chat read-only. The lockdown ends after
+	// RaidQuiet without joins.
+	RaidJoins    int      `json:"raid_joins"`
+	RaidInterval Duration `json:"raid_interval"`
+	RaidQuiet    Duration `json:"raid_quiet"`
+	RaidMute     Duration `json:"raid_mute"`
+	RaidLockChat bool     `json:"raid_lock_chat"`
+	// Probation is how long the newcomers can't send links, media and
+	// forwards, which are deleted. ProbationRestrict also restricts them
+	// to text messages on telegram.
+	Probation         Duration `json:"probation"`
+	ProbationRestrict bool     `json:"probation_restrict"`
+	// WarnLimit is how many warnings, given within WarnExpiry, apply the
+	// WarnPolicy to the user
+	WarnLimit  int        `json:"warn_limit"`
+	WarnExpiry Duration   `json:"warn_expiry"`
+	WarnPolicy KickPolicy `json:"warn_policy"`
+	// Filters delete the messages matching any of the rules
+	Filters []FilterRule `json:"filters"`
+	// Risk scores the newcomers, mapping the total to an action
+	Risk RiskSettings `json:"risk"`
+	// Detectors are the names of the detectors run on the newcomers,
+	// each one within DetectorTimeout
+	Detectors       []string `json:"detectors"`
+	DetectorTimeout Duration `json:"detector_timeout"`
+	// RescanAction is what to do with a known member found in a troll
+	// group by the periodic re-scan: "kick" or "alert" the admins
+	RescanAction string `json:"rescan_action"`
+	// SilentRemoval don't announce the removals, otherwise the
+	// announcement is deleted after RemovalTTL, when it is set
+	SilentRemoval bool     `json:"silent_removal"`
+	RemovalTTL    Duration `json:"removal_ttl"`
+	// DeleteJoinMessage delete the service message of trolls joining
+	DeleteJoinMessage bool `json:"delete_join_message"`
+	// ParseMode of the messages, HTML (default) or MarkdownV2
+	ParseMode string `json:"parse_mode"`
+	// Welcome is the template of the welcome message, replacing the
+	// default one, with Name, Mention, ChatTitle and MemberCount
+	Welcome        string          `json:"welcome"`
+	WelcomeButtons []WelcomeButton `json:"welcome_buttons"`
+	// GreetAll welcome every newcomer, not only the ones with a pass
+	GreetAll bool `json:"greet_all"`
+	// CheckForwards treat the authors of forwards from the troll groups,
+	// or the blacklisted chats, as their members
+	CheckForwards bool `json:"check_forwards"`
+	// CheckAuthors check the members not seen before on their first message
+	CheckAuthors bool `json:"check_authors"`
+}
+
+// Config is the bot configuration loaded from configFile.
+//
+// Defaults apply to every chat, while Chats override only the fields
+// they define, keyed by chat ID:
+//
+//	{
+//	  "shadow": false,
+//	  "defaults": {"shadow": false, "policy": {"action": "ban", "duration": "1d"}},
+//	  "chats": {"-1001280636766": {"shadow": true}}
+//	}
+type Config struct {
+	// Shadow enables the shadow mode for all chats
+	Shadow bool `json:"shadow"`
+	// RescanInterval is how often the known members are checked again,
+	// waiting RescanDelay between each member. Zero disables it.
+	RescanInterval Duration `json:"rescan_interval"`
+	RescanDelay    Duration `json:"rescan_delay"`
+	// BlacklistChats are chats, by @username or ID, treated like the
+	// troll groups when forwarding from them
+	BlacklistChats []string `json:"blacklist_chats"`
+	// BanLists are files or URLs of external ban lists, imported again
+	// at BanListInterval
+	BanLists        []string `json:"ban_lists"`
+	BanListInterval Duration `json:"ban_list_interval"`
+	// BlocklistKey is the file with the key signing the exported
+	// blocklists, as BlocklistIssuer. Only the blocklists signed by the
+	// BlocklistTrusted public keys are imported.
+	BlocklistKey     string   `json:"blocklist_key"`
+	BlocklistIssuer  string   `json:"blocklist_issuer"`
+	BlocklistTrusted []string `json:"blocklist_trusted"`
+	// LogChat is the ID of a chat or channel receiving the moderation actions
+	LogChat int64 `json:"log_chat"`
+
+	Defaults ChatSettings              `json:"defaults"`
+	Chats    map[int64]json.RawMessage `json:"chats"`
+
+	chats map[int64]ChatSettings
+}
+
+const configFile = "troll-shield.json"
+
+var config = defaultConfig()
+
+func defaultConfig() *Config {
+	return &Config{}
+}
+
+// parseConfig decode a configuration and resolve the settings of each chat
+func parseConfig(data []byte) (*Config, error) {
+	cfg := defaultConfig()
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, err
+	}
+
+	if err := compileFilters(cfg.Defaults.Filters); err != nil {
+		return nil, err
+	}
+	if err := cfg.Defaults.Risk.compile(); err != nil {
+		return nil, err
+	}
+	if err := checkDetectors(cfg.Defaults.Detectors); err != nil {
+		return nil, err
+	}
+	if err := checkPolicies(&cfg.Defaults); err != nil {
+		return nil, err
+	}
+	cfg.chats = make(map[int64]ChatSettings, len(cfg.Chats))
+	defaults, err := json.Marshal(cfg.Defaults)
+	if err != nil {
+		return nil, err
+	}
+	for chatID, raw := range cfg.Chats {
+		// decode the defaults again, so the chats don't share maps and slices
+		var settings ChatSettings
+		if err := json.Unmarshal(defaults, &settings); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &settings); err != nil {
+			return nil, err
+		}
+		if err := compileFilters(settings.Filters); err != nil {
+			return nil, err
+		}
+		if err := settings.Risk.compile(); err != nil {
+			return nil, err
+		}
+		if err := checkDetectors(settings.Detectors); err != nil {
+			return nil, err
+		}
+		if err := checkPolicies(&settings); err != nil {
+			return nil, err
+		}
+		cfg.chats[chatID] = settings
+	}
+
+	return cfg, nil
+}
+
+// checkPolicies return an error if any policy of the settings can't be applied
+func checkPolicies(settings *ChatSettings) error {
+	policies := append([]KickPolicy{settings.Policy, settings.WarnPolicy}, settings.Ladder...)
+	for _, policy := range settings.GroupPolicies {
+		policies = append(policies, policy)
+	}
+	for _, policy := range policies {
+		if err := policy.check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadConfig read the configuration file, falling back to the defaults
+// when the file doesn't exist. An invalid file is fatal, otherwise the
+// chats in shadow mode would kick for real.
+func loadConfig(fpath string) *Config {
+	data, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Fatalf("Reading %q failed: %v", fpath, err)
+		}
+		return defaultConfig()
+	}
+
+	cfg, err := parseConfig(data)
+	if err != nil {
+		log.Fatalf("Parsing %q go bad, got error: %v", fpath, err)
+	}
+
+	return cfg
+}
+
+// settingsFor return the settings of a chat
+func settingsFor(chatID int64) ChatSettings {
+	if settings, ok := config.chats[chatID]; ok {
+		return settings
+	}
+	return config.Defaults
+}
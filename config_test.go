@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestParseConfig(t *testing.T) {
+	cfg, err := parseConfig([]byte(`{
+		"shadow": true,
+		"defaults": {"shadow": true},
+		"chats": {"-100": {"shadow": false}, "-200": {}}
+	}`))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	if !cfg.Shadow {
+		t.Errorf("global shadow should be enabled")
+	}
+	if shadow := cfg.chats[-100].Shadow; shadow == nil || *shadow {
+		t.Errorf("chat -100 should override the default shadow setting")
+	}
+	if shadow := cfg.chats[-200].Shadow; shadow == nil || !*shadow {
+		t.Errorf("chat -200 should inherit the default shadow setting")
+	}
+
+	if _, err := parseConfig([]byte(`{"chats": []}`)); err == nil {
+		t.Errorf("parseConfig should fail with invalid chats")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	if cfg := loadConfig("no-such-file.json"); cfg == nil || cfg.Shadow {
+		t.Errorf("loadConfig should return the defaults when file doesn't exist, got %+v", cfg)
+	}
+
+	tmpfile, err := ioutil.TempFile("", "troll-shield.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(tmpfile.Name())
+	if err := tmpfile.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(tmpfile.Name(), []byte(`{"shadow": true}`), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if cfg := loadConfig(tmpfile.Name()); !cfg.Shadow {
+		t.Errorf("loadConfig should read the shadow setting, got %+v", cfg)
+	}
+}
+
+func TestSettingsFor(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"defaults": {"shadow": true}, "chats": {"1": {"shadow": false}}}`))
+	if shadow := settingsFor(1).Shadow; shadow == nil || *shadow {
+		t.Errorf("chat 1 should use its own settings")
+	}
+	if shadow := settingsFor(2).Shadow; shadow == nil || !*shadow {
+		t.Errorf("chat 2 should use the default settings")
+	}
+}
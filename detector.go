@@ -0,0 +1,204 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const defaultDetectorTimeout = 5 * time.Second
+
+// Detection is the input of the detectors: the user, the chat and the
+// update being checked, with the bots to query telegram
+type Detection struct {
+	Bot       TrollShieldBot
+	BotHidden TrollShieldBot
+	User      telegram.User
+	Chat      *telegram.Chat
+	Update    *telegram.Update
+	Risk      *RiskSettings
+}
+
+// Verdict of a detector: how many times its signal was found on the
+// user, zero when clean, with the evidence of it
+type Verdict struct {
+	Hits     int
+	Evidence []string
+}
+
+// Detector find one signal of trolling on the user. Detectors are run
+// concurrently and should give up when the context is done.
+type Detector interface {
+	Detect(ctx context.Context, d Detection) (Verdict, error)
+}
+
+// DetectorFunc adapts a function to the Detector interface
+type DetectorFunc func(ctx context.Context, d Detection) (Verdict, error)
+
+// Detect call the function
+func (f DetectorFunc) Detect(ctx context.Context, d Detection) (Verdict, error) {
+	return f(ctx, d)
+}
+
+// registeredDetector is a detector enabled by name in the config
+type registeredDetector struct {
+	name     string
+	detector Detector
+}
+
+// detectors are all the known detectors, in the order of the reports
+var detectors = []registeredDetector{
+	{riskTrollHouses, DetectorFunc(detectTrollHouses)},
+	{riskBanLists, DetectorFunc(detectBanLists)},
+	{riskNamePatterns, DetectorFunc(detectNamePatterns)},
+	{riskNoPhoto, DetectorFunc(detectNoPhoto)},
+	{riskNewAccount, DetectorFunc(detectNewAccount)},
+	{riskWeirdChars, DetectorFunc(detectWeirdChars)},
+	{riskBadNames, DetectorFunc(detectBadNames)},
+}
+
+// findDetector return the detector registered with the name
+func findDetector(name string) (Detector, bool) {
+	for _, d := range detectors {
+		if d.name == name {
+			return d.detector, true
+		}
+	}
+	return nil, false
+}
+
+// checkDetectors return an error if any of the names is not registered
+func checkDetectors(names []string) error {
+	for _, name := range names {
+		if _, ok := findDetector(name); !ok {
+			return fmt.Errorf("unknown detector %q", name)
+		}
+	}
+	return nil
+}
+
+// enabledDetectors return the detectors of the chat settings. By
+// default, only the troll houses and the ban lists are checked, or every
+// detector with a weight when the risk is scored.
+func enabledDetectors(settings *ChatSettings) []registeredDetector {
+	var enabled []registeredDetector
+	for _, d := range detectors {
+		switch {
+		case len(settings.Detectors) > 0:
+			if !contains(settings.Detectors, d.name) {
+				continue
+			}
+		case d.name == riskTrollHouses:
+		case d.name == riskBanLists:
+		case !settings.Risk.enabled() || settings.Risk.weight(d.name) == 0:
+			continue
+		}
+		enabled = append(enabled, d)
+	}
+	return enabled
+}
+
+// contains return true if the value is in the values
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// detectorTimeout return how long each detector can take in the chat
+func detectorTimeout(settings *ChatSettings) time.Duration {
+	if settings.DetectorTimeout > 0 {
+		return time.Duration(settings.DetectorTimeout)
+	}
+	return defaultDetectorTimeout
+}
+
+// detect run the detectors enabled in the chat of the update
+// concurrently, each one within the timeout, but the required ones.
+// Return the verdicts by detector name, without the failed or late ones.
+func detect(bot TrollShieldBot, botHidden TrollShieldBot, update *telegram.Update, user telegram.User) map[string]Verdict {
+	return detectWith(bot, botHidden, update, user, nil)
+}
+
+// detectWith run the enabled detectors like detect, but the ones with a
+// known verdict, which is used instead
+func detectWith(bot TrollShieldBot, botHidden TrollShieldBot, update *telegram.Update, user telegram.User, known map[string]Verdict) map[string]Verdict {
+	chat := update.Message.Chat
+	settings := settingsFor(chat.ID)
+	input := Detection{
+		Bot:       bot,
+		BotHidden: botHidden,
+		User:      user,
+		Chat:      chat,
+		Update:    update,
+		Risk:      &settings.Risk,
+	}
+	verdicts := make(map[string]Verdict)
+	var enabled []registeredDetector
+	for _, d := range enabledDetectors(&settings) {
+		if verdict, ok := known[d.name]; ok {
+			verdicts[d.name] = verdict
+		} else {
+			enabled = append(enabled, d)
+		}
+	}
+	timeout := detectorTimeout(&settings)
+
+	type result struct {
+		name    string
+		verdict Verdict
+		err     error
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	results := make(chan result, len(enabled))
+	for _, d := range enabled {
+		go func(d registeredDetector) {
+			verdict, err := d.detector.Detect(ctx, input)
+			results <- result{d.name, verdict, err}
+		}(d)
+	}
+
+	// the detectors give up when the context is done, so all of them are
+	// waited, dropping the late verdicts
+	for range enabled {
+		r := <-results
+		switch {
+		case r.err != nil:
+			log.Printf("[!] Detector %v on %v failed: %v", r.name, user.ID, r.err)
+		case ctx.Err() != nil:
+			log.Printf("[!] Detector %v on %v was late: %v", r.name, user.ID, ctx.Err())
+		default:
+			verdicts[r.name] = r.verdict
+		}
+	}
+	return verdicts
+}
+
+// detectTrollHouses find the troll houses of the user. The lookups
+// unfinished when ctx is done are recorded as failures.
+func detectTrollHouses(ctx context.Context, d Detection) (Verdict, error) {
+	houses := splitHouses(checkTrollHouses(ctx, d.Bot, d.BotHidden, d.Chat.ID, d.User))
+	return Verdict{Hits: len(houses), Evidence: houses}, nil
+}
+
+// membershipVerdict return the verdict of the troll houses of the
+// statuses, with the groups where the user is a member
+func membershipVerdict(statuses []TrollHouseStatus) Verdict {
+	var verdict Verdict
+	for _, status := range statuses {
+		if status.IsMember() {
+			verdict.Hits++
+			verdict.Evidence = append(verdict.Evidence, status.Group)
+		}
+	}
+	return verdict
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestEnabledDetectors(t *testing.T) {
+	names := func(settings ChatSettings) []string {
+		var enabled []string
+		for _, d := range enabledDetectors(&settings) {
+			enabled = append(enabled, d.name)
+		}
+		return enabled
+	}
+	tableTest := []struct {
+		settings ChatSettings
+		expected []string
+	}{
+		{ChatSettings{}, []string{riskTrollHouses, riskBanLists}},
+		{ChatSettings{Risk: RiskSettings{Kick: 100, Weights: map[string]int{riskNoPhoto: 0}}}, []string{riskTrollHouses, riskBanLists, riskNamePatterns, riskNewAccount, riskWeirdChars, riskBadNames}},
+		{ChatSettings{Detectors: []string{riskBadNames, riskNoPhoto}}, []string{riskNoPhoto, riskBadNames}},
+	}
+	for _, test := range tableTest {
+		got := names(test.settings)
+		if len(got) != len(test.expected) {
+			t.Errorf("enabledDetectors(%+v): expected %v, got %v", test.settings, test.expected, got)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("enabledDetectors(%+v): expected %v, got %v", test.settings, test.expected, got)
+				break
+			}
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(d []registeredDetector) { detectors = d }(detectors)
+	gaveUp := make(chan error, 1)
+	detectors = []registeredDetector{
+		{"slow", DetectorFunc(func(ctx context.Context, d Detection) (Verdict, error) {
+			<-ctx.Done()
+			gaveUp <- ctx.Err()
+			return Verdict{Hits: 1}, ctx.Err()
+		})},
+		{"fast", DetectorFunc(func(ctx context.Context, d Detection) (Verdict, error) {
+			return Verdict{Hits: 1, Evidence: []string{d.User.UserName}}, nil
+		})},
+		{"broken", DetectorFunc(func(ctx context.Context, d Detection) (Verdict, error) {
+			return Verdict{Hits: 1}, context.Canceled
+		})},
+	}
+	config, _ = parseConfig([]byte(`{"defaults": {"detectors": ["slow", "fast", "broken"], "detector_timeout": "50ms"}}`))
+	update := telegram.Update{Message: &telegram.Message{Chat: &telegram.Chat{ID: -1}}}
+
+	start := time.Now()
+	verdicts := detect(&BotMockup{}, &BotMockup{}, &update, telegram.User{UserName: "troll"})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("detect should give up on the slow detectors, took %v", elapsed)
+	}
+	if _, ok := verdicts["slow"]; ok {
+		t.Errorf("detect should drop the late verdicts, got %+v", verdicts)
+	}
+	if _, ok := verdicts["broken"]; ok {
+		t.Errorf("detect should drop the failed verdicts, got %+v", verdicts)
+	}
+	if v := verdicts["fast"]; v.Hits != 1 || len(v.Evidence) != 1 || v.Evidence[0] != "troll" {
+		t.Errorf("detect expected the fast verdict, got %+v", verdicts)
+	}
+	select {
+	case <-gaveUp:
+	case <-time.After(time.Second):
+		t.Errorf("detect should cancel the late detectors")
+	}
+}
+
+func TestDetectTrollHouses(t *testing.T) {
+	defer func(g []string) { trollGroups = g }(trollGroups)
+	trollGroups = []string{"@rolisvaldo", "@trolleira"}
+	update := telegram.Update{Message: &telegram.Message{Chat: &telegram.Chat{ID: -1}}}
+	verdicts := detect(&BotMockup{}, &BotMockup{}, &update, telegram.User{ID: 1})
+	if v := verdicts[riskTrollHouses]; v.Hits != 2 || v.Evidence[1] != "@trolleira" {
+		t.Errorf("detect expected the troll houses, got %+v", verdicts)
+	}
+}
+
+// HangMockup never answers the membership lookups
+type HangMockup struct {
+	BotMockup
+}
+
+func (bot *HangMockup) GetChatMember(c telegram.ChatConfigWithUser) (telegram.ChatMember, error) {
+	select {}
+}
+
+func TestDetectTrollHousesTimeout(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(g []string) { trollGroups = g }(trollGroups)
+	trollGroups = []string{"@rolisvaldo"}
+	config, _ = parseConfig([]byte(`{"defaults": {"detector_timeout": "10ms"}}`))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	statuses := trollHouseStatus(ctx, &HangMockup{}, 1)
+	if len(statuses) != 1 || statuses[0].Err != context.DeadlineExceeded {
+		t.Errorf("trollHouseStatus should give up on the hung lookups, got %+v", statuses)
+	}
+
+	update := telegram.Update{Message: &telegram.Message{Chat: &telegram.Chat{ID: -1}}}
+	start := time.Now()
+	detect(&BotMockup{}, &HangMockup{}, &update, telegram.User{ID: 1})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("detect should give up on the hung troll houses, took %v", elapsed)
+	}
+}
+
+func TestParseConfigDetectors(t *testing.T) {
+	if _, err := parseConfig([]byte(`{"chats": {"-1": {"detectors": ["crystal_ball"]}}}`)); err == nil {
+		t.Errorf("parseConfig should fail with unknown detectors")
+	}
+}
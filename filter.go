@@ -0,0 +1,300 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf16"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// filter kinds
+const (
+	filterWords          = "words"
+	filterRegexp         = "regexp"
+	filterDenyDomains    = "deny_domains"
+	filterAllowDomains   = "allow_domains"
+	filterTrollForwards  = "troll_forwards"
+	filterNewMemberMedia = "new_member_media"
+)
+
+// filterReasons are the catalog IDs describing what each kind catches
+var filterReasons = map[string]string{
+	filterWords:          "filter_words",
+	filterRegexp:         "filter_regexp",
+	filterDenyDomains:    "filter_deny",
+	filterAllowDomains:   "filter_allow",
+	filterTrollForwards:  "filter_forwards",
+	filterNewMemberMedia: "filter_media",
+}
+
+// filter actions, besides kick
+const (
+	filterDelete = "delete"
+	filterMute   = "mute"
+)
+
+const (
+	defaultFilterMute   = time.Hour
+	defaultFilterWindow = 24 * time.Hour
+)
+
+// FilterRule match messages by kind, with the values:
+// - words: any of the words, ignoring the case
+// - regexp: any of the regular expressions
+// - deny_domains: links to any of the domains or their subdomains
+// - allow_domains: links to domains other than these
+// - troll_forwards: forwards from the troll groups or blacklisted chats
+// - new_member_media: media of users which joined within Window
+// The matched messages are deleted, and their authors are warned,
+// muted for Duration or kicked by the kick policy, following Action.
+type FilterRule struct {
+	Kind     string   `json:"kind"`
+	Values   []string `json:"values"`
+	Action   string   `json:"action"`
+	Duration Duration `json:"duration"`
+	Window   Duration `json:"window"`
+
+	regexps []*regexp.Regexp
+}
+
+// compile the regular expressions of the rule, checking its kind and action
+func (r *FilterRule) compile() error {
+	if _, ok := filterReasons[r.Kind]; !ok {
+		return fmt.Errorf("unknown filter kind %q", r.Kind)
+	}
+	switch r.Action {
+	case "", filterDelete, actionWarn, filterMute, actionKick:
+	default:
+		return fmt.Errorf("unknown filter action %q", r.Action)
+	}
+	if r.Kind != filterRegexp {
+		return nil
+	}
+	r.regexps = make([]*regexp.Regexp, len(r.Values))
+	for i, value := range r.Values {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return err
+		}
+		r.regexps[i] = re
+	}
+	return nil
+}
+
+// compileFilters compile the regular expressions of all the rules
+func compileFilters(rules []FilterRule) error {
+	for i := range rules {
+		if err := rules[i].compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// messageText return the text or the caption of the message, with its entities
+func messageText(msg *telegram.Message) (string, []telegram.MessageEntity) {
+	if msg.Caption != "" {
+		if msg.CaptionEntities != nil {
+			return msg.Caption, *msg.CaptionEntities
+		}
+		return msg.Caption, nil
+	}
+	if msg.Entities != nil {
+		return msg.Text, *msg.Entities
+	}
+	return msg.Text, nil
+}
+
+// messageLinks return the links of the message entities, which have
+// offsets in UTF-16 code units
+func messageLinks(msg *telegram.Message) []string {
+	text, entities := messageText(msg)
+	var encoded []uint16
+	var links []string
+	for _, entity := range entities {
+		switch entity.Type {
+		case "text_link":
+			links = append(links, entity.URL)
+		case "url":
+			if encoded == nil {
+				encoded = utf16.Encode([]rune(text))
+			}
+			if end := entity.Offset + entity.Length; entity.Offset >= 0 && end <= len(encoded) {
+				links = append(links, string(utf16.Decode(encoded[entity.Offset:end])))
+			}
+		}
+	}
+	return links
+}
+
+// linkHost return the lowercase host of the link, which may lack the scheme
+func linkHost(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// matchDomain return true if the host is any of the domains or their subdomains
+func matchDomain(host string, domains []string) bool {
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasMedia return true if the message has any media attached
+func hasMedia(msg *telegram.Message) bool {
+	return msg.Photo != nil || msg.Video != nil || msg.Document != nil ||
+		msg.Animation != nil || msg.Sticker != nil || msg.Audio != nil ||
+		msg.Voice != nil || msg.VideoNote != nil
+}
+
+// newMember return true if the user joined the chat within the window
+func newMember(chatID int64, userID int, window time.Duration, now time.Time) bool {
+	joined := store.joined(chatID, userID)
+	return !joined.IsZero() && now.Sub(joined) < window
+}
+
+// match return true if the message is caught by the rule
+func (r *FilterRule) match(msg *telegram.Message) bool {
+	switch r.Kind {
+	case filterWords:
+		text, _ := messageText(msg)
+		words := strings.FieldsFunc(strings.ToLower(text), func(c rune) bool {
+			return !unicode.IsLetter(c) && !unicode.IsNumber(c)
+		})
+		for _, word := range words {
+			for _, value := range r.Values {
+				if word == strings.ToLower(value) {
+					return true
+				}
+			}
+		}
+	case filterRegexp:
+		text, _ := messageText(msg)
+		for _, re := range r.regexps {
+			if re.MatchString(text) {
+				return true
+			}
+		}
+	case filterDenyDomains:
+		for _, link := range messageLinks(msg) {
+			if matchDomain(linkHost(link), r.Values) {
+				return true
+			}
+		}
+	case filterAllowDomains:
+		for _, link := range messageLinks(msg) {
+			if !matchDomain(linkHost(link), r.Values) {
+				return true
+			}
+		}
+	case filterTrollForwards:
+		return blacklistedChat(msg.ForwardFromChat) != ""
+	case filterNewMemberMedia:
+		window := time.Duration(r.Window)
+		if window <= 0 {
+			window = defaultFilterWindow
+		}
+		return hasMedia(msg) && newMember(msg.Chat.ID, msg.From.ID, window, time.Now())
+	}
+	return false
+}
+
+// matchFilters return the first rule of the chat catching the message
+func matchFilters(rules []FilterRule, msg *telegram.Message) (FilterRule, bool) {
+	for _, rule := range rules {
+		if rule.match(msg) {
+			return rule, true
+		}
+	}
+	return FilterRule{}, false
+}
+
+// checkFilters delete the messages caught by the filters of the chat,
+// acting on the author as the rule says. Return true if it was caught.
+func checkFilters(bot TrollShieldBot, update *telegram.Update) bool {
+	if !messageEvent(update) || newChatMemberEvent(update) || update.Message.From == nil || update.Message.Chat.IsPrivate() {
+		return false
+	}
+	chatID := update.Message.Chat.ID
+	rules := settingsFor(chatID).Filters
+	user := *update.Message.From
+	if len(rules) == 0 || fromAdminEvent(update) || store.trusted(user.ID) {
+		return false
+	}
+	rule, ok := matchFilters(rules, update.Message)
+	if !ok {
+		return false
+	}
+	applyFilter(bot, update, user, rule)
+	return true
+}
+
+// applyFilter delete the message and act on its author
+func applyFilter(bot TrollShieldBot, update *telegram.Update, user telegram.User, rule FilterRule) {
+	chatID := update.Message.Chat.ID
+	locale := chatLocale(chatID)
+	reason := tr(locale, filterReasons[rule.Kind], nil)
+	entry := AuditEntry{
+		ChatID:   chatID,
+		UserID:   user.ID,
+		UserName: getUserName(user),
+		Action:   "filter-" + rule.Action,
+		Reason:   rule.Kind,
+	}
+	if shadowMode(chatID) {
+		log.Printf("[shadow] message of %v would be filtered by %v", user.ID, rule.Kind)
+		entry.Action = "shadow-" + entry.Action
+		auditLog(bot, entry)
+		notifyAdmins(bot, update, chatFormat(chatID, "shadow_filter", vars{"User": user, "Reason": reason}))
+		return
+	}
+	defer deleteReplied(bot, update)
+
+	chatMember := telegram.ChatMemberConfig{ChatID: chatID, UserID: user.ID}
+	switch rule.Action {
+	case actionWarn:
+		warnUser(bot, update, user, reason, "")
+	case filterMute:
+		mute := rule.Duration
+		if mute <= 0 {
+			mute = Duration(defaultFilterMute)
+		}
+		policy := KickPolicy{Action: actionRestrict, Duration: mute}
+		if resp, err := applyPolicy(bot, chatMember, policy); !resp.Ok || err != nil {
+			log.Printf("[!] Muting %v did not work, error code %v: %v", user.ID, resp.ErrorCode, resp.Description)
+			return
+		}
+		auditLog(bot, entry)
+		announceRemoval(bot, update, chatFormat(chatID, "filter_mute", vars{
+			"User":     user,
+			"Duration": formatDuration(locale, mute),
+			"Reason":   reason,
+		}))
+	case actionKick:
+		motive := tr(locale, "motive_filter", vars{"Reason": reason})
+		if kickUser(bot, update, user, nil, rule.Kind, motive) == nil {
+			store.forgetMember(chatID, user.ID)
+		}
+	default:
+		entry.Action = "filter-" + filterDelete
+		auditLog(bot, entry)
+	}
+}
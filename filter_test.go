@@ -0,0 +1,158 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestMessageLinks(t *testing.T) {
+	msg := &telegram.Message{
+		Text: "olá 😀 veja spam.com e isso",
+		Entities: &[]telegram.MessageEntity{
+			{Type: "url", Offset: 12, Length: 8},
+			{Type: "text_link", Offset: 23, Length: 4, URL: "https://evil.org/x"},
+			{Type: "bold", Offset: 0, Length: 3},
+		},
+	}
+	links := messageLinks(msg)
+	if len(links) != 2 || links[0] != "spam.com" || links[1] != "https://evil.org/x" {
+		t.Errorf("messageLinks expected [spam.com https://evil.org/x], got %v", links)
+	}
+}
+
+func TestMatchDomain(t *testing.T) {
+	tableTest := []struct {
+		link     string
+		expected bool
+	}{
+		{"spam.com", true},
+		{"https://www.Spam.com/x", true},
+		{"http://notspam.com", false},
+		{"lisp.com.br", false},
+	}
+	for _, test := range tableTest {
+		if got := matchDomain(linkHost(test.link), []string{"spam.com"}); got != test.expected {
+			t.Errorf("matchDomain(%q): expected %v, got %v", test.link, test.expected, got)
+		}
+	}
+}
+
+func TestFilterMatch(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+	store.seeMember(1, telegram.User{ID: 2}, true)
+	link := func(url string) *[]telegram.MessageEntity {
+		return &[]telegram.MessageEntity{{Type: "text_link", URL: url}}
+	}
+	chat := &telegram.Chat{ID: 1}
+	tableTest := []struct {
+		rule     FilterRule
+		msg      telegram.Message
+		expected bool
+	}{
+		{FilterRule{Kind: filterWords, Values: []string{"Cassino"}}, telegram.Message{Text: "melhor cassino!"}, true},
+		{FilterRule{Kind: filterWords, Values: []string{"cassino"}}, telegram.Message{Text: "cassinos"}, false},
+		{FilterRule{Kind: filterWords, Values: []string{"cassino"}}, telegram.Message{Caption: "CASSINO"}, true},
+		{FilterRule{Kind: filterRegexp, Values: []string{`(?i)pump\s+now`}}, telegram.Message{Text: "PUMP  now"}, true},
+		{FilterRule{Kind: filterDenyDomains, Values: []string{"spam.com"}}, telegram.Message{Entities: link("http://a.spam.com")}, true},
+		{FilterRule{Kind: filterAllowDomains, Values: []string{"lisp.com.br"}}, telegram.Message{Entities: link("https://lisp.com.br")}, false},
+		{FilterRule{Kind: filterAllowDomains, Values: []string{"lisp.com.br"}}, telegram.Message{Entities: link("https://spam.com")}, true},
+		{FilterRule{Kind: filterTrollForwards}, telegram.Message{ForwardFromChat: &telegram.Chat{UserName: "MlBrasil"}}, true},
+		{FilterRule{Kind: filterTrollForwards}, telegram.Message{ForwardFromChat: &telegram.Chat{UserName: "commonlispbr"}}, false},
+		{FilterRule{Kind: filterNewMemberMedia}, telegram.Message{From: &telegram.User{ID: 2}, Photo: &[]telegram.PhotoSize{}}, true},
+		{FilterRule{Kind: filterNewMemberMedia}, telegram.Message{From: &telegram.User{ID: 3}, Photo: &[]telegram.PhotoSize{}}, false},
+		{FilterRule{Kind: filterNewMemberMedia}, telegram.Message{From: &telegram.User{ID: 2}, Text: "oi"}, false},
+	}
+	for _, test := range tableTest {
+		if err := test.rule.compile(); err != nil {
+			t.Fatalf("compile %+v failed: %v", test.rule, err)
+		}
+		test.msg.Chat = chat
+		if got := test.rule.match(&test.msg); got != test.expected {
+			t.Errorf("%v rule %v on %+v: expected %v, got %v", test.rule.Kind, test.rule.Values, test.msg, test.expected, got)
+		}
+	}
+
+	rule := FilterRule{Kind: filterNewMemberMedia, Window: Duration(time.Nanosecond)}
+	msg := telegram.Message{Chat: chat, From: &telegram.User{ID: 2}, Photo: &[]telegram.PhotoSize{}}
+	if rule.match(&msg) {
+		t.Errorf("new_member_media should allow media after the window")
+	}
+}
+
+func TestCheckFilters(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	config, _ = parseConfig([]byte(`{"chats": {"-1": {"filters": [
+		{"kind": "words", "values": ["cassino"], "action": "warn"},
+		{"kind": "regexp", "values": ["pump"], "action": "mute", "duration": "1d"},
+		{"kind": "deny_domains", "values": ["spam.com"], "action": "kick"}
+	]}}}`))
+	store = newStore("")
+	bot := DeleteMockup{deleted: make(chan int, 10)}
+	message := func(id int, text string, from string) *telegram.Update {
+		return &telegram.Update{Message: &telegram.Message{
+			MessageID: id,
+			Text:      text,
+			From:      &telegram.User{ID: 0, UserName: from},
+			Chat:      &telegram.Chat{ID: -1, Type: "supergroup"},
+		}}
+	}
+
+	if checkFilters(&bot, message(1, "olá", "troll")) {
+		t.Errorf("checkFilters should allow clean messages")
+	}
+	if checkFilters(&bot, message(2, "cassino", "lerax")) {
+		t.Errorf("checkFilters should ignore the admins")
+	}
+
+	tableTest := []struct {
+		text     string
+		expected string
+	}{
+		{"cassino", "@troll recebeu um aviso (1/3): uma palavra proibida."},
+		{"pump", "@troll foi silenciado por 1 dia por enviar um texto proibido."},
+	}
+	for i, test := range tableTest {
+		if !checkFilters(&bot, message(i+3, test.text, "troll")) {
+			t.Errorf("checkFilters should catch %q", test.text)
+		}
+		if id := <-bot.deleted; id != i+3 {
+			t.Errorf("checkFilters should delete the message %v, got %v", i+3, id)
+		}
+		if got := bot.lastText(); got != test.expected {
+			t.Errorf("checkFilters on %q: expected %q, got %q", test.text, test.expected, got)
+		}
+	}
+
+	update := message(9, "veja spam.com", "troll")
+	update.Message.Entities = &[]telegram.MessageEntity{{Type: "url", Offset: 5, Length: 8}}
+	checkFilters(&bot, update)
+	<-bot.deleted
+	if got := bot.lastText(); !strings.HasPrefix(got, "@troll foi banido por 1 dia porque enviou um link proibido") {
+		t.Errorf("checkFilters should kick by the policy, got %q", got)
+	}
+
+	store.exempt(telegram.User{ID: 0, UserName: "troll"})
+	sent := len(bot.sent)
+	checkFilters(&bot, update)
+	<-bot.deleted
+	if len(bot.sent) != sent {
+		t.Errorf("checkFilters should not kick the exempted users, got %q", bot.lastText())
+	}
+}
+
+func TestParseConfigFilters(t *testing.T) {
+	if _, err := parseConfig([]byte(`{"defaults": {"filters": [{"kind": "regexp", "values": ["("]}]}}`)); err == nil {
+		t.Errorf("parseConfig should fail with invalid regular expressions")
+	}
+	if _, err := parseConfig([]byte(`{"chats": {"-1": {"filters": [{"kind": "link"}]}}}`)); err == nil {
+		t.Errorf("parseConfig should fail with unknown filter kinds")
+	}
+	if _, err := parseConfig([]byte(`{"defaults": {"filters": [{"kind": "words", "action": "ban"}]}}`)); err == nil {
+		t.Errorf("parseConfig should fail with unknown filter actions")
+	}
+}
@@ -0,0 +1,252 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"sync"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	defaultFloodInterval     = 10 * time.Second
+	defaultFloodMute         = 10 * time.Minute
+	defaultFloodStrikes      = 3
+	defaultFloodStrikeExpiry = 24 * time.Hour
+)
+
+// floodPruneInterval is how often the idle flooders are dropped
+const floodPruneInterval = time.Minute
+
+// floodKey identify an user in a chat
+type floodKey struct {
+	chatID int64
+	userID int
+}
+
+// floodMessage is a message inside the sliding window
+type floodMessage struct {
+	time time.Time
+	text string
+}
+
+// floodStrike count the floods of an user until they expire
+type floodStrike struct {
+	count int
+	last  time.Time
+}
+
+// flooders are the recent messages, the strikes and the mutes of each
+// user by chat, pruned at floodPruneInterval
+var flooders = struct {
+	sync.Mutex
+	window  map[floodKey][]floodMessage
+	strikes map[floodKey]floodStrike
+	muted   map[floodKey]time.Time
+	pruned  time.Time
+}{
+	window:  make(map[floodKey][]floodMessage),
+	strikes: make(map[floodKey]floodStrike),
+	muted:   make(map[floodKey]time.Time),
+}
+
+// floodEnabled return true if the chat has a flood limit
+func floodEnabled(settings ChatSettings) bool {
+	return settings.FloodMessages > 0 || settings.FloodRepeats > 0
+}
+
+// floodInterval return the size of the sliding window of the chat
+func floodInterval(settings ChatSettings) time.Duration {
+	if settings.FloodInterval > 0 {
+		return time.Duration(settings.FloodInterval)
+	}
+	return defaultFloodInterval
+}
+
+// floodMute return how long flooders are muted on the chat
+func floodMute(settings ChatSettings) Duration {
+	if settings.FloodMute > 0 {
+		return settings.FloodMute
+	}
+	return Duration(defaultFloodMute)
+}
+
+// floodStrikes return on which mute the kick policy is applied instead
+func floodStrikes(settings ChatSettings) int {
+	if settings.FloodStrikes > 0 {
+		return settings.FloodStrikes
+	}
+	return defaultFloodStrikes
+}
+
+// floodStrikeExpiry return how long the strikes of the chat are kept
+func floodStrikeExpiry(settings ChatSettings) time.Duration {
+	if settings.FloodStrikeExpiry > 0 {
+		return time.Duration(settings.FloodStrikeExpiry)
+	}
+	return defaultFloodStrikeExpiry
+}
+
+// pruneFlooders drop the windows without recent messages, the expired
+// mutes and strikes, the caller must hold the lock
+func pruneFlooders(now time.Time) {
+	for key, window := range flooders.window {
+		last := window[len(window)-1].time
+		if !last.After(now.Add(-floodInterval(settingsFor(key.chatID)))) {
+			delete(flooders.window, key)
+		}
+	}
+	for key, until := range flooders.muted {
+		if !now.Before(until) {
+			delete(flooders.muted, key)
+		}
+	}
+	for key, s := range flooders.strikes {
+		if now.Sub(s.last) > floodStrikeExpiry(settingsFor(key.chatID)) {
+			delete(flooders.strikes, key)
+		}
+	}
+	flooders.pruned = now
+}
+
+// recordMessage add the message to the window of the user, dropping the
+// old ones, and return if the user is flooding and is already muted
+func recordMessage(settings ChatSettings, key floodKey, now time.Time, text string) (flooding bool, muted bool) {
+	flooders.Lock()
+	defer flooders.Unlock()
+	if now.Sub(flooders.pruned) >= floodPruneInterval {
+		pruneFlooders(now)
+	}
+	if now.Before(flooders.muted[key]) {
+		return true, true
+	}
+	start := now.Add(-floodInterval(settings))
+	var window []floodMessage
+	for _, msg := range flooders.window[key] {
+		if msg.time.After(start) {
+			window = append(window, msg)
+		}
+	}
+	window = append(window, floodMessage{now, text})
+	flooders.window[key] = window
+
+	repeats := 0
+	for _, msg := range window {
+		if text != "" && msg.text == text {
+			repeats++
+		}
+	}
+	return settings.FloodMessages > 0 && len(window) > settings.FloodMessages ||
+		settings.FloodRepeats > 0 && repeats > settings.FloodRepeats, false
+}
+
+// strike count a flood of the user, muting it for the flood mute of the
+// chat. The strikes older than the expiry of the chat are forgotten.
+func strike(settings ChatSettings, key floodKey, now time.Time) int {
+	flooders.Lock()
+	defer flooders.Unlock()
+	delete(flooders.window, key)
+	s := flooders.strikes[key]
+	if now.Sub(s.last) > floodStrikeExpiry(settings) {
+		s.count = 0
+	}
+	s.count++
+	s.last = now
+	flooders.strikes[key] = s
+	flooders.muted[key] = now.Add(time.Duration(floodMute(settings)))
+	return s.count
+}
+
+// forgetFlooder clear the strikes of the user, after being removed
+func forgetFlooder(key floodKey) {
+	flooders.Lock()
+	defer flooders.Unlock()
+	delete(flooders.strikes, key)
+	delete(flooders.muted, key)
+}
+
+// checkFlood delete the messages above the flood limits of the chat,
+// muting the user, or applying the kick policy on repeated floods.
+// Return true if the message was a flood.
+func checkFlood(bot TrollShieldBot, update *telegram.Update) bool {
+	if !messageEvent(update) || newChatMemberEvent(update) || update.Message.From == nil || update.Message.Chat.IsPrivate() {
+		return false
+	}
+	chatID := update.Message.Chat.ID
+	settings := settingsFor(chatID)
+	user := *update.Message.From
+	if !floodEnabled(settings) || fromAdminEvent(update) || store.trusted(user.ID) {
+		return false
+	}
+
+	key := floodKey{chatID, user.ID}
+	now := time.Unix(int64(update.Message.Date), 0)
+	flooding, muted := recordMessage(settings, key, now, update.Message.Text)
+	if !flooding {
+		return false
+	}
+	if shadowMode(chatID) {
+		if !muted {
+			shadowFlood(bot, update, user, settings, key, now)
+		}
+		return true
+	}
+	defer deleteReplied(bot, update)
+	if muted {
+		return true
+	}
+
+	policy := KickPolicy{Action: actionRestrict, Duration: floodMute(settings)}
+	if strike(settings, key, now) >= floodStrikes(settings) {
+		// the exempted users are only muted
+		motive := tr(chatLocale(chatID), "motive_flood", nil)
+		if err := kickUser(bot, update, user, nil, "flood", motive); err != errExempted {
+			if err == nil {
+				forgetFlooder(key)
+				store.forgetMember(chatID, user.ID)
+			}
+			return true
+		}
+	}
+	chatMember := telegram.ChatMemberConfig{ChatID: chatID, UserID: user.ID}
+	if resp, err := applyPolicy(bot, chatMember, policy); !resp.Ok || err != nil {
+		log.Printf("[!] Punishing flood of %v did not work, error code %v: %v", user.ID, resp.ErrorCode, resp.Description)
+		return true
+	}
+	auditLog(bot, AuditEntry{
+		ChatID:   chatID,
+		UserID:   user.ID,
+		UserName: getUserName(user),
+		Action:   "flood-mute",
+		Reason:   "flood",
+	})
+	announceRemoval(bot, update, chatFormat(chatID, "flood_mute", vars{
+		"User":     user,
+		"Duration": formatDuration(chatLocale(chatID), policy.Duration),
+	}))
+	return true
+}
+
+// shadowFlood notify the admins about a flood that would be punished
+func shadowFlood(bot TrollShieldBot, update *telegram.Update, user telegram.User, settings ChatSettings, key floodKey, now time.Time) {
+	chatID := update.Message.Chat.ID
+	policy := KickPolicy{Action: actionRestrict, Duration: floodMute(settings)}
+	if strike(settings, key, now) >= floodStrikes(settings) {
+		forgetFlooder(key)
+		policy = resolvePolicy(chatID, nil, store.offences(user.ID))
+	}
+	log.Printf("[shadow] %v (%v) would be %v from %v for flooding", getUserName(user), user.ID, policy.Action, chatID)
+	auditLog(bot, AuditEntry{
+		ChatID:   chatID,
+		UserID:   user.ID,
+		UserName: getUserName(user),
+		Action:   "shadow-flood-" + policy.Action,
+		Reason:   "flood",
+	})
+	notifyAdmins(bot, update, chatFormat(chatID, "shadow_flood", vars{
+		"User":   user,
+		"Action": describePolicy(chatLocale(chatID), policy),
+	}))
+}
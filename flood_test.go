@@ -0,0 +1,152 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestRecordMessage(t *testing.T) {
+	settings := ChatSettings{FloodMessages: 3, FloodRepeats: 1}
+	key := floodKey{-1, 1}
+	defer forgetFlooder(key)
+	tableTest := []struct {
+		second   int64
+		text     string
+		flooding bool
+	}{
+		{0, "a", false},
+		{1, "b", false},
+		{2, "a", true},   // repeated
+		{20, "a", false}, // out of the window
+		{21, "b", false},
+		{22, "c", false},
+		{23, "d", true}, // too many
+	}
+	for _, test := range tableTest {
+		now := time.Unix(test.second, 0)
+		if flooding, muted := recordMessage(settings, key, now, test.text); flooding != test.flooding || muted {
+			t.Errorf("recordMessage(%v, %q): expected flooding %v, got %v (muted %v)", test.second, test.text, test.flooding, flooding, muted)
+		}
+	}
+
+	strike(ChatSettings{FloodMute: Duration(time.Second)}, key, time.Unix(29, 0))
+	if flooding, muted := recordMessage(settings, key, time.Unix(29, 0), "e"); !flooding || !muted {
+		t.Errorf("recordMessage should report muted users, got %v %v", flooding, muted)
+	}
+}
+
+func TestFloodStrikeExpiry(t *testing.T) {
+	settings := ChatSettings{FloodStrikeExpiry: Duration(time.Hour)}
+	key := floodKey{-2, 1}
+	defer forgetFlooder(key)
+	now := time.Unix(0, 0)
+	if got := strike(settings, key, now); got != 1 {
+		t.Errorf("strike should count the first flood, got %v", got)
+	}
+	if got := strike(settings, key, now.Add(30*time.Minute)); got != 2 {
+		t.Errorf("strike should count the recent floods, got %v", got)
+	}
+	if got := strike(settings, key, now.Add(3*time.Hour)); got != 1 {
+		t.Errorf("strike should forget the expired floods, got %v", got)
+	}
+}
+
+func TestPruneFlooders(t *testing.T) {
+	idle, muted, striked := floodKey{-3, 1}, floodKey{-3, 2}, floodKey{-3, 3}
+	for _, key := range []floodKey{idle, muted, striked} {
+		defer forgetFlooder(key)
+	}
+	now := time.Unix(1000, 0)
+	settings := ChatSettings{FloodMessages: 10}
+	recordMessage(settings, idle, now, "a")
+	strike(settings, muted, now)
+	strike(settings, striked, now)
+
+	flooders.Lock()
+	pruneFlooders(now.Add(time.Hour))
+	_, windowKept := flooders.window[idle]
+	_, muteKept := flooders.muted[muted]
+	_, strikeKept := flooders.strikes[striked]
+	flooders.Unlock()
+	if windowKept || muteKept || !strikeKept {
+		t.Errorf("pruneFlooders should drop the idle windows and the expired mutes only, got %v %v %v", windowKept, muteKept, strikeKept)
+	}
+
+	flooders.Lock()
+	pruneFlooders(now.Add(2 * defaultFloodStrikeExpiry))
+	_, strikeKept = flooders.strikes[striked]
+	flooders.Unlock()
+	if strikeKept {
+		t.Errorf("pruneFlooders should drop the expired strikes")
+	}
+}
+
+func TestCheckFlood(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	config, _ = parseConfig([]byte(`{"chats": {"-1": {"flood_messages": 1, "flood_strikes": 2}}}`))
+	store = newStore("")
+	bot := DeleteMockup{deleted: make(chan int, 10)}
+	troll := telegram.User{ID: 0, UserName: "troll"}
+	defer forgetFlooder(floodKey{-1, troll.ID})
+	message := func(id int, date int) *telegram.Update {
+		return &telegram.Update{Message: &telegram.Message{
+			MessageID: id,
+			Date:      date,
+			Text:      "spam",
+			From:      &troll,
+			Chat:      &telegram.Chat{ID: -1, Type: "supergroup"},
+		}}
+	}
+
+	if checkFlood(&bot, message(1, 0)) {
+		t.Errorf("checkFlood should allow the first message")
+	}
+	if !checkFlood(&bot, message(2, 0)) {
+		t.Errorf("checkFlood should catch the second message")
+	}
+	if id := <-bot.deleted; id != 2 {
+		t.Errorf("checkFlood should delete the flood, got %v", id)
+	}
+	if got := bot.lastText(); got != "@troll foi silenciado por 10 minutos por flood." {
+		t.Errorf("checkFlood should mute the flooder, got %q", got)
+	}
+
+	if !checkFlood(&bot, message(3, 60)) {
+		t.Errorf("checkFlood should delete the messages of muted users")
+	}
+	if id := <-bot.deleted; id != 3 {
+		t.Errorf("checkFlood should delete the flood, got %v", id)
+	}
+
+	checkFlood(&bot, message(4, 1000))
+	checkFlood(&bot, message(5, 1000))
+	<-bot.deleted
+	if got := bot.lastText(); !strings.HasPrefix(got, "@troll foi banido por 1 dia porque fez flood no grupo") {
+		t.Errorf("checkFlood should apply the kick policy on the second strike, got %q", got)
+	}
+	if offences := store.offences(troll.ID); offences != 1 {
+		t.Errorf("checkFlood should record the offence, got %v", offences)
+	}
+
+	store.exempt(troll)
+	checkFlood(&bot, message(7, 2000))
+	checkFlood(&bot, message(8, 2000))
+	<-bot.deleted
+	checkFlood(&bot, message(9, 3000))
+	checkFlood(&bot, message(10, 3000))
+	<-bot.deleted
+	if got := bot.lastText(); got != "@troll foi silenciado por 10 minutos por flood." {
+		t.Errorf("checkFlood should only mute the exempted users, got %q", got)
+	}
+	store.revoke(troll.ID)
+
+	admin := message(6, 1000)
+	admin.Message.From = &telegram.User{ID: 0, UserName: "lerax"}
+	if checkFlood(&bot, admin) {
+		t.Errorf("checkFlood should ignore the admins")
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"text/template/parse"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// modePlain is the parse mode of messages without formatting, like the
+// callback answers and the logs
+const modePlain = ""
+
+// formatted is a text already escaped for a parse mode, which is not
+// escaped again when used as a template variable
+type formatted string
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// markdownSpecials must be escaped everywhere on MarkdownV2
+const markdownSpecials = "_*[]()~`>#+-=|{}.!\\"
+
+// chatMode return the parse mode of the messages sent to the chat
+func chatMode(chatID int64) string {
+	if settingsFor(chatID).ParseMode == telegram.ModeMarkdownV2 {
+		return telegram.ModeMarkdownV2
+	}
+	return telegram.ModeHTML
+}
+
+// escape the text to be shown as is on the parse mode
+func escape(mode string, text string) string {
+	switch mode {
+	case telegram.ModeHTML:
+		return htmlEscaper.Replace(text)
+	case telegram.ModeMarkdownV2:
+		var b strings.Builder
+		for _, r := range text {
+			if strings.ContainsRune(markdownSpecials, r) {
+				b.WriteByte('\\')
+			}
+			b.WriteRune(r)
+		}
+		return b.String()
+	}
+	return text
+}
+
+// mention return a clickable mention of the user. Users without an
+// username are mentioned by a tg://user link with their name.
+func mention(mode string, user telegram.User) formatted {
+	name := getUserName(user)
+	if user.UserName != "" || mode == modePlain {
+		return formatted(escape(mode, name))
+	}
+	link := fmt.Sprintf("tg://user?id=%d", user.ID)
+	if mode == telegram.ModeMarkdownV2 {
+		return formatted(fmt.Sprintf("[%s](%s)", escape(mode, name), link))
+	}
+	return formatted(fmt.Sprintf(`<a href="%s">%s</a>`, link, escape(mode, name)))
+}
+
+// escapeVars return the variables escaped for the parse mode, the users
+// are replaced by their mentions
+func escapeVars(mode string, data vars) vars {
+	escaped := make(vars, len(data))
+	for k, v := range data {
+		switch v := v.(type) {
+		case formatted:
+			escaped[k] = v
+		case telegram.User:
+			escaped[k] = mention(mode, v)
+		case string:
+			escaped[k] = formatted(escape(mode, v))
+		case error:
+			escaped[k] = formatted(escape(mode, v.Error()))
+		default:
+			escaped[k] = v
+		}
+	}
+	return escaped
+}
+
+// escapeNodes escape the text of the template for the parse mode, so
+// the catalog can be written without caring about it
+func escapeNodes(mode string, node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, n := range node.Nodes {
+			escapeNodes(mode, n)
+		}
+	case *parse.TextNode:
+		node.Text = []byte(escape(mode, string(node.Text)))
+	case *parse.IfNode:
+		escapeNodes(mode, node.List)
+		escapeNodes(mode, node.ElseList)
+	case *parse.RangeNode:
+		escapeNodes(mode, node.List)
+		escapeNodes(mode, node.ElseList)
+	case *parse.WithNode:
+		escapeNodes(mode, node.List)
+		escapeNodes(mode, node.ElseList)
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestEscape(t *testing.T) {
+	tableTest := []struct {
+		mode     string
+		text     string
+		expected string
+	}{
+		{modePlain, "<b>a_b</b>", "<b>a_b</b>"},
+		{telegram.ModeHTML, "<b>a & b</b>", "&lt;b&gt;a &amp; b&lt;/b&gt;"},
+		{telegram.ModeHTML, `"a_b"`, `"a_b"`},
+		{telegram.ModeMarkdownV2, "a_b (c). d!", `a\_b \(c\)\. d\!`},
+		{telegram.ModeMarkdownV2, `\`, `\\`},
+	}
+	for _, test := range tableTest {
+		if got := escape(test.mode, test.text); got != test.expected {
+			t.Errorf("escape(%q, %q): expected %q, got %q", test.mode, test.text, test.expected, got)
+		}
+	}
+}
+
+func TestMention(t *testing.T) {
+	named := telegram.User{ID: 7, FirstName: "<Manoel>", LastName: "[Neto]"}
+	tableTest := []struct {
+		mode     string
+		user     telegram.User
+		expected formatted
+	}{
+		{modePlain, named, "<Manoel> [Neto]"},
+		{telegram.ModeHTML, named, `<a href="tg://user?id=7">&lt;Manoel&gt; [Neto]</a>`},
+		{telegram.ModeMarkdownV2, named, `[<Manoel\> \[Neto\]](tg://user?id=7)`},
+		{telegram.ModeHTML, telegram.User{ID: 7, UserName: "le_rax"}, "@le_rax"},
+		{telegram.ModeMarkdownV2, telegram.User{ID: 7, UserName: "le_rax"}, `@le\_rax`},
+	}
+	for _, test := range tableTest {
+		if got := mention(test.mode, test.user); got != test.expected {
+			t.Errorf("mention(%q, %+v): expected %q, got %q", test.mode, test.user, test.expected, got)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	data := vars{"User": telegram.User{UserName: "troll"}, "ID": 1, "Houses": "@a_b"}
+	tableTest := []struct {
+		mode     string
+		id       string
+		data     vars
+		expected formatted
+	}{
+		{telegram.ModeHTML, "rescan_alert", data, "@troll (1) agora é membro do grupo: @a_b."},
+		{telegram.ModeMarkdownV2, "rescan_alert", data, `@troll \(1\) agora é membro do grupo: @a\_b\.`},
+		{telegram.ModeHTML, "target_usage", vars{"Command": "/check"}, "Uso: /check &lt;@username|ID&gt;, ou responda uma mensagem do usuário."},
+		{telegram.ModeHTML, "check_error", vars{"Group": "@g", "Error": errors.New("<nope>")}, "@g: erro: &lt;nope&gt;"},
+		{telegram.ModeMarkdownV2, "check_member", vars{"Group": "@g", "Status": formatted("*member*")}, "@g: membro \\(*member*\\)"},
+	}
+	for _, test := range tableTest {
+		if got := format(test.mode, "pt", test.id, test.data); got != test.expected {
+			t.Errorf("format(%q, %q): expected %q, got %q", test.mode, test.id, test.expected, got)
+		}
+	}
+}
+
+func TestChatMode(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"chats": {"1": {"parse_mode": "MarkdownV2"}}}`))
+	if got := chatMode(1); got != telegram.ModeMarkdownV2 {
+		t.Errorf("chat 1 should use MarkdownV2, got %v", got)
+	}
+	if got := chatMode(2); got != telegram.ModeHTML {
+		t.Errorf("chat 2 should use HTML, got %v", got)
+	}
+}
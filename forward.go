@@ -0,0 +1,98 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// blacklistedChat return the troll group, including the imported ones,
+// or the blacklisted chat from the config, matching the chat by username
+// or ID. Otherwise, return an empty string.
+func blacklistedChat(chat *telegram.Chat) string {
+	if chat == nil {
+		return ""
+	}
+	id := strconv.FormatInt(chat.ID, 10)
+	for _, groups := range [][]string{trollHouses(), config.BlacklistChats} {
+		for _, group := range groups {
+			name := strings.TrimLeft(group, "@")
+			if chat.UserName != "" && strings.EqualFold(name, chat.UserName) || name == id {
+				return group
+			}
+		}
+	}
+	return ""
+}
+
+// checkForward treat the author of a forward from a troll group, or a
+// blacklisted chat, as a member of it. Return true if the author was
+// kicked.
+func checkForward(bot TrollShieldBot, update *telegram.Update) bool {
+	msg := update.Message
+	author := msg.From
+	if author == nil || author.IsBot || msg.Chat.IsPrivate() || fromAdminEvent(update) || store.trusted(author.ID) {
+		return false
+	}
+	trollHouse := blacklistedChat(msg.ForwardFromChat)
+	if trollHouse == "" {
+		return false
+	}
+	if err := kickTroll(bot, update, *author, trollHouse); err != nil {
+		return false
+	}
+	deleteReplied(bot, update)
+	store.forgetMember(msg.Chat.ID, author.ID)
+	return true
+}
+
+// checkSenderChat treat the messages sent on behalf of a troll group, or
+// a blacklisted chat like a channel, as sent by a member of it: the
+// sender chat is banned from the chat and the message deleted. The
+// anonymous admins of the chat are sent on behalf of the chat itself.
+// Return true if the sender chat was banned.
+func checkSenderChat(bot TrollShieldBot, update *telegram.Update, senderChat *telegram.Chat) bool {
+	msg := update.Message
+	if senderChat == nil || senderChat.ID == msg.Chat.ID || msg.Chat.IsPrivate() {
+		return false
+	}
+	trollHouse := blacklistedChat(senderChat)
+	if trollHouse == "" {
+		return false
+	}
+	name := senderChat.Title
+	if senderChat.UserName != "" {
+		name = "@" + senderChat.UserName
+	}
+	entry := AuditEntry{
+		ChatID:   msg.Chat.ID,
+		UserName: name,
+		Action:   "ban-sender",
+		Reason:   trollHouse,
+	}
+	data := vars{"Chat": name, "Houses": trollHouse}
+	if shadowMode(msg.Chat.ID) {
+		log.Printf("[shadow] %v would be banned from %v", name, msg.Chat.ID)
+		entry.Action = "shadow-" + entry.Action
+		auditLog(bot, entry)
+		notifyAdmins(bot, update, chatFormat(msg.Chat.ID, "shadow_sender", data))
+		return true
+	}
+	_, err := bot.MakeRequest("banChatSenderChat", url.Values{
+		"chat_id":        {strconv.FormatInt(msg.Chat.ID, 10)},
+		"sender_chat_id": {strconv.FormatInt(senderChat.ID, 10)},
+	})
+	if err != nil {
+		log.Printf("[!] Banning %v from %v failed: %v", name, msg.Chat.ID, err)
+		return false
+	}
+	defer deleteReplied(bot, update)
+	auditLog(bot, entry)
+	announceRemoval(bot, update, chatFormat(msg.Chat.ID, "sender_ban", data))
+	return true
+}
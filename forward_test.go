@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestBlacklistedChat(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"blacklist_chats": ["@trollchannel", "-1001"]}`))
+	tableTest := []struct {
+		chat     *telegram.Chat
+		expected string
+	}{
+		{nil, ""},
+		{&telegram.Chat{ID: 5, UserName: "MLBrasil"}, "@mlbrasil"},
+		{&telegram.Chat{ID: 6, UserName: "trollchannel"}, "@trollchannel"},
+		{&telegram.Chat{ID: -1001}, "-1001"},
+		{&telegram.Chat{ID: 7, UserName: "commonlispbr"}, ""},
+	}
+	for _, test := range tableTest {
+		if got := blacklistedChat(test.chat); got != test.expected {
+			t.Errorf("blacklistedChat(%+v): expected %q, got %q", test.chat, test.expected, got)
+		}
+	}
+}
+
+func TestCheckForward(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+	bot := DeleteMockup{deleted: make(chan int, 10)}
+	troll := telegram.User{ID: 0, UserName: "troll"}
+	update := telegram.Update{Message: &telegram.Message{
+		MessageID: 3,
+		From:      &troll,
+		Chat:      &telegram.Chat{ID: -1, Type: "supergroup"},
+	}}
+
+	if checkForward(&bot, &update) {
+		t.Errorf("checkForward should ignore messages not forwarded")
+	}
+	update.Message.ForwardFromChat = &telegram.Chat{UserName: "commonlispbr"}
+	if checkForward(&bot, &update) {
+		t.Errorf("checkForward should ignore forwards from other chats")
+	}
+
+	update.Message.ForwardFromChat = &telegram.Chat{UserName: "mlbrasil"}
+	if !checkForward(&bot, &update) {
+		t.Errorf("checkForward should kick the author of forwards from troll groups")
+	}
+	if id := <-bot.deleted; id != 3 {
+		t.Errorf("checkForward should delete the forward, got %v", id)
+	}
+	if got := bot.lastText(); !strings.Contains(got, "é membro do grupo: @mlbrasil") {
+		t.Errorf("checkForward should announce the troll group, got %q", got)
+	}
+}
+
+func TestCheckSenderChat(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"blacklist_chats": ["@trollchannel"], "chats": {"-2": {"shadow": true}}}`))
+	bot := DeleteMockup{deleted: make(chan int, 10)}
+	update := telegram.Update{Message: &telegram.Message{
+		MessageID: 3,
+		From:      &telegram.User{ID: 136817688, IsBot: true},
+		Chat:      &telegram.Chat{ID: -1, Type: "supergroup"},
+	}}
+
+	if checkSenderChat(&bot, &update, nil) {
+		t.Errorf("checkSenderChat should ignore messages of users")
+	}
+	if checkSenderChat(&bot, &update, &telegram.Chat{ID: -1}) {
+		t.Errorf("checkSenderChat should ignore the anonymous admins")
+	}
+	channel := &telegram.Chat{ID: -100, UserName: "trollchannel", Type: "channel"}
+	if !checkSenderChat(&bot, &update, channel) {
+		t.Errorf("checkSenderChat should ban the blacklisted channels")
+	}
+	if id := <-bot.deleted; id != 3 {
+		t.Errorf("checkSenderChat should delete the message, got %v", id)
+	}
+	if got := bot.lastText(); !strings.Contains(got, "em nome de @trollchannel") {
+		t.Errorf("checkSenderChat should announce the ban, got %q", got)
+	}
+
+	update.Message.Chat.ID = -2
+	if !checkSenderChat(&bot, &update, channel) || len(bot.deleted) != 0 {
+		t.Errorf("checkSenderChat should only notify in shadow mode")
+	}
+	if got := bot.lastText(); !strings.Contains(got, "[modo sombra]") {
+		t.Errorf("checkSenderChat should notify the admins, got %q", got)
+	}
+}
@@ -6,69 +6,187 @@
 package main
 
 import (
+	"os"
 	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
+var kills int64
+
+// countKill increment and save the kills
+func countKill() {
+	kills++
+	if err := saveKills(killsFile, kills); err != nil {
+		log.Printf("saving kills failed: %v", err)
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "blocklist" {
+		config = loadConfig(configFile)
+		store = loadStore(storeFile)
+		if err := blocklistCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	setupLogging()
+	config = loadConfig(configFile)
 	bot, botHidden, err := setupBots()
-	botUser := bot.Self.UserName
 	if err != nil {
 		log.Fatal(err.Error())
 	}
-	kills := loadKills(killsFile)
+	kills = loadKills(killsFile)
 	log.Printf("Currently kill state: %v", kills)
-	for update := range getUpdates(bot) {
-		if messageEvent(&update) {
-			// Exit automatically from group after the bot receive a message from it
-			for _, trollGroup := range trollGroups {
-				if fromChatEvent(&update, strings.TrimLeft(trollGroup, "@")) {
-					leaveChat(bot, &update, trollGroup)
-				}
+	shadowKills = loadKills(shadowKillsFile)
+	store = loadStore(storeFile)
+	store.loadBanLists(banListsFile)
+	updates := getUpdates(bot)
+	hits := startRescan(botHidden)
+	startBanLists()
+	for {
+		select {
+		case hit := <-hits:
+			if handleRescanHit(bot, hit) {
+				countKill()
 			}
+		case chatID := <-quietChats:
+			quietLockdown(bot, chatID)
+		case update := <-updates:
+			handleUpdate(bot, botHidden, &update.Update, update.SenderChat)
 		}
+	}
+}
 
-		if commandEvent(&update) {
-			msg := update.Message.Text
-			if checkCommand(botUser, msg, "/ping") {
-				reply(bot, &update, "Estou vivo.")
-			}
+func handleUpdate(bot *telegram.BotAPI, botHidden *telegram.BotAPI, update *telegram.Update, senderChat *telegram.Chat) {
+	botUser := bot.Self.UserName
+	if captchaEvent(update) {
+		captchaCallback(bot, update.CallbackQuery)
+	}
 
-			if checkCommand(botUser, msg, "/kills") {
-				reportKills(bot, &update, kills)
+	if messageEvent(update) {
+		// Exit automatically from group after the bot receive a message from it
+		for _, trollGroup := range trollGroups {
+			if fromChatEvent(update, strings.TrimLeft(trollGroup, "@")) {
+				leaveChat(bot, update, trollGroup)
 			}
-
-			if checkCommand(botUser, msg, "/pass") && fromAdminEvent(&update) {
-				addPassList(bot, &update)
+		}
+		if settingsFor(update.Message.Chat.ID).CheckForwards {
+			if checkSenderChat(bot, update, senderChat) {
+				return
+			}
+			if checkForward(bot, update) {
+				countKill()
+				return
+			}
+		}
+		if checkFlood(bot, update) || checkFilters(bot, update) || checkProbation(bot, update) {
+			return
+		}
+		if updateRoster(update) && settingsFor(update.Message.Chat.ID).CheckAuthors {
+			if checkAuthor(bot, botHidden, update) {
+				countKill()
 			}
 		}
+	}
 
-		if newChatMemberEvent(&update) {
-			for _, member := range *update.Message.NewChatMembers {
-				if pass, ok := hasPass(member); ok {
-					removePassList(bot, &update, pass)
-					welcomeMessage(bot, &update, member)
-					continue
-				}
+	if commandEvent(update) {
+		msg := update.Message.Text
+		if checkCommand(botUser, msg, "/ping") {
+			replyMessage(bot, update, "ping", nil)
+		}
 
-				if trollHouse := findTrollHouses(botHidden, member.ID); trollHouse != "" {
-					err := kickTroll(bot, &update, member, trollHouse)
-					if err == nil {
-						kills++
-						if err := saveKills(killsFile, kills); err != nil {
-							log.Printf("saving kills failed: %v", err)
-						}
-					}
-				}
+		if checkCommand(botUser, msg, "/kills") {
+			reportKills(bot, update, kills)
+		}
+
+		if checkCommand(botUser, msg, "/pass") && fromAdminEvent(update) {
+			addPassList(bot, update)
+		}
+
+		if checkCommand(botUser, msg, "/unban") && fromAdminEvent(update) {
+			unbanUser(bot, update)
+		}
 
-				// Exit automatically from groups when I'm joining it
-				for _, trollGroup := range trollGroups {
-					if fromChatEvent(&update, strings.TrimLeft(trollGroup, "@")) && member.UserName == bot.Self.UserName {
-						leaveChat(bot, &update, trollGroup)
-					}
+		if checkCommand(botUser, msg, "/revoke") && fromAdminEvent(update) {
+			revokeExemption(bot, update)
+		}
+
+		if checkCommand(botUser, msg, "/trust") && fromAdminEvent(update) {
+			trustUser(bot, update)
+		}
+
+		if checkCommand(botUser, msg, "/untrust") && fromAdminEvent(update) {
+			untrustUser(bot, update)
+		}
+
+		if checkCommand(botUser, msg, "/check") && fromAdminEvent(update) {
+			checkUser(bot, botHidden, update)
+		}
+
+		if checkCommand(botUser, msg, "/ban") && fromAdminEvent(update) {
+			banUser(bot, update)
+		}
+
+		if checkCommand(botUser, msg, "/warns") && fromAdminEvent(update) {
+			listWarnings(bot, update)
+		} else if checkCommand(botUser, msg, "/warn") && fromAdminEvent(update) {
+			warnCommand(bot, update)
+		}
+
+		if checkCommand(botUser, msg, "/approve") && fromAdminEvent(update) {
+			approveMember(bot, update)
+		}
+
+		if checkCommand(botUser, msg, "/unlock") && fromAdminEvent(update) {
+			unlockChat(bot, update)
+		}
+
+		if checkCommand(botUser, msg, "/importlist") && fromAdminEvent(update) {
+			importList(bot, update)
+		}
+
+		if checkCommand(botUser, msg, "/setwelcome") && fromAdminEvent(update) {
+			setWelcome(bot, update)
+		}
+
+		if checkCommand(botUser, msg, "/welcome") && fromAdminEvent(update) {
+			previewWelcome(bot, update)
+		}
+	}
+
+	// the uploaded files have the command in the caption
+	if messageEvent(update) && update.Message.Document != nil && fromAdminEvent(update) &&
+		checkCommand(botUser, update.Message.Caption, "/importlist") {
+		importList(bot, update)
+	}
+
+	if newChatMemberEvent(update) {
+		chatID := update.Message.Chat.ID
+		lockdown := checkRaid(bot, update)
+		for _, member := range *update.Message.NewChatMembers {
+			kicked := false
+			if pass, ok := hasPass(member); ok {
+				removePassList(bot, update, pass)
+				welcomeMessage(bot, update, member)
+			} else if !store.trusted(member.ID) {
+				kicked = screenMember(bot, botHidden, update, member, lockdown)
+				if kicked {
+					countKill()
 				}
+			}
+			if !kicked {
+				store.seeMember(chatID, member, true)
+			}
 
+			// Exit automatically from groups when I'm joining it
+			for _, trollGroup := range trollGroups {
+				if fromChatEvent(update, strings.TrimLeft(trollGroup, "@")) && member.UserName == bot.Self.UserName {
+					leaveChat(bot, update, trollGroup)
+				}
 			}
+
 		}
 	}
 }
@@ -0,0 +1,289 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"bytes"
+	"text/template"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const defaultLocale = "pt"
+
+// vars are the variables available to a message template
+type vars map[string]interface{}
+
+// catalog of the message templates by locale and message ID
+var catalog = map[string]map[string]string{
+	"pt": {
+		"ping":            "Estou vivo.",
+		"kills_odd":       "{{.Kills}} foram sacrificados.",
+		"kills_even":      "Já taquei o pau em {{.Kills}} trolls!",
+		"welcome":         "Olá {{.Mention}}! Seja bem-vindo ao grupo oficial de Common Lisp do Brasil.\nLeia as regras em: https://lisp.com.br/rules.html.",
+		"leave":           "Nesse grupo há trolls. Dou-me a liberdade de ir embora. Adeus.",
+		"pass_added":      "O passe para \"{{.Pass}}\" foi adicionado.",
+		"pass_consumed":   "O passe para \"{{.Pass}}\" foi consumido.",
+		"removal":         "{{.User}} foi {{.Action}} porque {{.Motive}} (ofensa nº {{.Offences}}). Para mais informações, acione o nosso SAC 24h: @skhaz.",
+		"motive_troll":    "é membro do grupo: {{.Houses}}",
+		"motive_admin":    "um administrador decidiu{{if .Reason}}: {{.Reason}}{{end}}",
+		"policy_kick":     "removido",
+		"policy_ban":      "banido por {{.Duration}}",
+		"policy_perm":     "banido permanentemente",
+		"policy_restrict": "restrito a somente leitura{{if .Duration}} por {{.Duration}}{{end}}",
+		"policy_warn":     "avisado",
+		"weeks":           "{{.N}} {{if eq .N 1}}semana{{else}}semanas{{end}}",
+		"days":            "{{.N}} {{if eq .N 1}}dia{{else}}dias{{end}}",
+		"hours":           "{{.N}} {{if eq .N 1}}hora{{else}}horas{{end}}",
+		"minutes":         "{{.N}} {{if eq .N 1}}minuto{{else}}minutos{{end}}",
+		"shadow_kick":     "[modo sombra] {{.User}} seria {{.Action}} porque {{.Motive}} (ofensa nº {{.Offences}}). Remoções simuladas: {{.Kills}}.",
+		"shadow_leave":    "[modo sombra] Eu iria embora de {{.Group}}.",
+		"captcha":         "Olá {{.User}}! Para participar do grupo, responda em até {{.Timeout}}: quanto é {{.A}} + {{.B}}?",
+		"captcha_other":   "Esse desafio não é para você.",
+		"captcha_expired": "Esse desafio expirou.",
+		"captcha_right":   "Resposta certa, seja bem-vindo!",
+		"captcha_wrong":   "Resposta errada.",
+		"rescan_alert":    "{{.User}} ({{.ID}}) agora é membro do grupo: {{.Houses}}.",
+		"target_usage":    "Uso: {{.Command}} <@username|ID>, ou responda uma mensagem do usuário.",
+		"unban_usage":     "Uso: /unban <@username|ID> [pass], ou responda uma mensagem do usuário.",
+		"unban_failed":    "Não consegui desbanir {{.User}}.",
+		"unban":           "{{.User}} foi desbanido e não será mais removido automaticamente.{{if .Pass}} O passe para \"{{.Pass}}\" foi adicionado.{{end}}",
+		"revoke_missing":  "{{.User}} não estava isento.",
+		"revoke":          "{{.User}} voltará a ser verificado automaticamente.",
+		"trust":           "{{.User}} agora é um usuário confiável.",
+		"untrust_missing": "{{.User}} não era um usuário confiável.",
+		"untrust":         "{{.User}} não é mais um usuário confiável.",
+		"check":           "Verificação de {{.User}} ({{.ID}}):",
+		"check_member":    "{{.Group}}: membro ({{.Status}})",
+		"check_left":      "{{.Group}}: não é membro{{if .Status}} ({{.Status}}){{end}}",
+		"check_error":     "{{.Group}}: erro: {{.Error}}",
+		"check_trusted":   "Usuário confiável.",
+		"check_exempt":    "Isento de remoções automáticas.",
+		"check_offences":  "Ofensas: {{.Offences}}.",
+		"check_banned":    "Na lista de banimento: {{.List}}.",
+		"ban_usage":       "Uso: /ban [duração] [motivo], respondendo uma mensagem do usuário.",
+		"ban_failed":      "Não consegui banir {{.User}}.",
+		"motive_flood":    "fez flood no grupo",
+		"flood_mute":      "{{.User}} foi silenciado por {{.Duration}} por flood.",
+		"shadow_flood":    "[modo sombra] {{.User}} seria {{.Action}} por flood.",
+		"raid_lockdown":   "Raid detectado: {{.Joins}} entradas em {{.Interval}}. O grupo está em bloqueio e os novos membros ficarão restritos por {{.Mute}}. Use /unlock para encerrar.",
+		"shadow_raid":     "[modo sombra] Raid detectado: {{.Joins}} entradas em {{.Interval}}. Eu colocaria o grupo em bloqueio.",
+		"raid_end":        "O bloqueio do grupo foi encerrado.",
+		"raid_not_locked": "O grupo não está em bloqueio.",
+		"motive_filter":   "enviou {{.Reason}}",
+		"filter_mute":     "{{.User}} foi silenciado por {{.Duration}} por enviar {{.Reason}}.",
+		"shadow_filter":   "[modo sombra] Eu removeria a mensagem de {{.User}} por conter {{.Reason}}.",
+		"sender_ban":      "As mensagens em nome de {{.Chat}} foram banidas porque é do grupo troll: {{.Houses}}.",
+		"shadow_sender":   "[modo sombra] Eu baniria as mensagens em nome de {{.Chat}}, que é do grupo troll: {{.Houses}}.",
+		"filter_words":    "uma palavra proibida",
+		"filter_regexp":   "um texto proibido",
+		"filter_deny":     "um link proibido",
+		"filter_allow":    "um link não permitido",
+		"filter_forwards": "um encaminhamento de grupo troll",
+		"filter_media":    "mídia antes do fim do período de novato",
+		"approve":         "{{.User}} foi aprovado e não está mais em período de novato.",
+		"warn":            "{{.User}} recebeu um aviso ({{.Count}}/{{.Limit}}){{if .Reason}}: {{.Reason}}{{end}}.",
+		"warn_usage":      "Uso: /warn [motivo], respondendo uma mensagem do usuário.",
+		"warns":           "Avisos de {{.User}}: {{.Count}}/{{.Limit}}",
+		"warns_item":      "{{.Time}}{{if .Reason}}: {{.Reason}}{{end}}{{if .Actor}} (por @{{.Actor}}){{end}}",
+		"motive_warns":    "atingiu {{.Limit}} avisos",
+		"shadow_warns":    "[modo sombra] {{.User}} atingiu o limite de avisos e seria {{.Action}}.",
+		"motive_risk":     "teve pontuação de risco {{.Score}}",
+		"motive_banlist":  "está na lista de banimento: {{.Lists}}",
+		"check_risk":      "Risco: {{.Score}}, {{.Action}}.",
+		"check_signal":    "{{.Name}}: +{{.Score}}{{if .Evidence}} ({{.Evidence}}){{end}}",
+		"risk_allow":      "permitir",
+		"risk_probation":  "período de novato",
+		"risk_captcha":    "captcha",
+		"risk_kick":       "remover",
+		"importlist":      "A lista de bloqueio de {{.Issuer}} foi importada: {{.Users}} usuários e {{.Groups}} grupos novos.",
+		"import_usage":    "Uso: /importlist, enviando ou respondendo o arquivo da lista de bloqueio.",
+		"import_failed":   "Não consegui importar a lista de bloqueio, veja o log do bot.",
+		"welcome_usage":   "Uso: /welcome preview",
+		"welcome_set":     "A mensagem de boas-vindas foi alterada.",
+		"welcome_reset":   "A mensagem de boas-vindas voltou ao padrão.",
+		"welcome_invalid": "Mensagem de boas-vindas inválida: {{.Error}}",
+		"audit_user":      "Usuário",
+		"audit_chat":      "Grupo",
+		"audit_reason":    "Motivo",
+		"audit_actor":     "Por",
+	},
+	"en": {
+		"ping":            "I'm alive.",
+		"kills_odd":       "{{.Kills}} were sacrificed.",
+		"kills_even":      "I already smashed {{.Kills}} trolls!",
+		"welcome":         "Hello {{.Mention}}! Welcome to the official Common Lisp Brazil group.\nRead the rules at: https://lisp.com.br/rules.html.",
+		"leave":           "There are trolls in this group. I'll take the liberty of leaving. Goodbye.",
+		"pass_added":      "The pass for \"{{.Pass}}\" was added.",
+		"pass_consumed":   "The pass for \"{{.Pass}}\" was consumed.",
+		"removal":         "{{.User}} was {{.Action}} because {{.Motive}} (offence #{{.Offences}}). For more information, call our 24h support: @skhaz.",
+		"motive_troll":    "is a member of the group: {{.Houses}}",
+		"motive_admin":    "an admin decided{{if .Reason}}: {{.Reason}}{{end}}",
+		"policy_kick":     "removed",
+		"policy_ban":      "banned for {{.Duration}}",
+		"policy_perm":     "banned permanently",
+		"policy_restrict": "restricted to read-only{{if .Duration}} for {{.Duration}}{{end}}",
+		"policy_warn":     "warned",
+		"weeks":           "{{.N}} {{if eq .N 1}}week{{else}}weeks{{end}}",
+		"days":            "{{.N}} {{if eq .N 1}}day{{else}}days{{end}}",
+		"hours":           "{{.N}} {{if eq .N 1}}hour{{else}}hours{{end}}",
+		"minutes":         "{{.N}} {{if eq .N 1}}minute{{else}}minutes{{end}}",
+		"shadow_kick":     "[shadow mode] {{.User}} would be {{.Action}} because {{.Motive}} (offence #{{.Offences}}). Simulated removals: {{.Kills}}.",
+		"shadow_leave":    "[shadow mode] I would leave {{.Group}}.",
+		"captcha":         "Hello {{.User}}! To join the group, answer within {{.Timeout}}: how much is {{.A}} + {{.B}}?",
+		"captcha_other":   "This challenge is not for you.",
+		"captcha_expired": "This challenge has expired.",
+		"captcha_right":   "Right answer, welcome!",
+		"captcha_wrong":   "Wrong answer.",
+		"rescan_alert":    "{{.User}} ({{.ID}}) is now a member of the group: {{.Houses}}.",
+		"target_usage":    "Usage: {{.Command}} <@username|ID>, or reply to a message of the user.",
+		"unban_usage":     "Usage: /unban <@username|ID> [pass], or reply to a message of the user.",
+		"unban_failed":    "I couldn't unban {{.User}}.",
+		"unban":           "{{.User}} was unbanned and won't be removed automatically anymore.{{if .Pass}} The pass for \"{{.Pass}}\" was added.{{end}}",
+		"revoke_missing":  "{{.User}} was not exempted.",
+		"revoke":          "{{.User}} will be checked automatically again.",
+		"trust":           "{{.User}} is now a trusted user.",
+		"untrust_missing": "{{.User}} was not a trusted user.",
+		"untrust":         "{{.User}} is not a trusted user anymore.",
+		"check":           "Check of {{.User}} ({{.ID}}):",
+		"check_member":    "{{.Group}}: member ({{.Status}})",
+		"check_left":      "{{.Group}}: not a member{{if .Status}} ({{.Status}}){{end}}",
+		"check_error":     "{{.Group}}: error: {{.Error}}",
+		"check_trusted":   "Trusted user.",
+		"check_exempt":    "Exempted from automated removals.",
+		"check_offences":  "Offences: {{.Offences}}.",
+		"check_banned":    "In the ban list: {{.List}}.",
+		"ban_usage":       "Usage: /ban [duration] [reason], replying to a message of the user.",
+		"ban_failed":      "I couldn't ban {{.User}}.",
+		"motive_flood":    "flooded the chat",
+		"flood_mute":      "{{.User}} was muted for {{.Duration}} for flooding.",
+		"shadow_flood":    "[shadow mode] {{.User}} would be {{.Action}} for flooding.",
+		"raid_lockdown":   "Raid detected: {{.Joins}} joins in {{.Interval}}. The chat is in lockdown and the newcomers will be restricted for {{.Mute}}. Use /unlock to end it.",
+		"shadow_raid":     "[shadow mode] Raid detected: {{.Joins}} joins in {{.Interval}}. I would put the chat in lockdown.",
+		"raid_end":        "The lockdown of the chat has ended.",
+		"raid_not_locked": "The chat is not in lockdown.",
+		"motive_filter":   "sent {{.Reason}}",
+		"filter_mute":     "{{.User}} was muted for {{.Duration}} for sending {{.Reason}}.",
+		"shadow_filter":   "[shadow mode] I would remove the message of {{.User}} for containing {{.Reason}}.",
+		"sender_ban":      "The messages on behalf of {{.Chat}} were banned, since it is the troll group: {{.Houses}}.",
+		"shadow_sender":   "[shadow mode] I would ban the messages on behalf of {{.Chat}}, the troll group: {{.Houses}}.",
+		"filter_words":    "a forbidden word",
+		"filter_regexp":   "a forbidden text",
+		"filter_deny":     "a forbidden link",
+		"filter_allow":    "a link not allowed",
+		"filter_forwards": "a forward from a troll group",
+		"filter_media":    "media before the end of the newcomer period",
+		"approve":         "{{.User}} was approved and is not a newcomer anymore.",
+		"warn":            "{{.User}} got a warning ({{.Count}}/{{.Limit}}){{if .Reason}}: {{.Reason}}{{end}}.",
+		"warn_usage":      "Usage: /warn [reason], replying to a message of the user.",
+		"warns":           "Warnings of {{.User}}: {{.Count}}/{{.Limit}}",
+		"warns_item":      "{{.Time}}{{if .Reason}}: {{.Reason}}{{end}}{{if .Actor}} (by @{{.Actor}}){{end}}",
+		"motive_warns":    "reached {{.Limit}} warnings",
+		"shadow_warns":    "[shadow mode] {{.User}} reached the warning limit and would be {{.Action}}.",
+		"motive_risk":     "had a risk score of {{.Score}}",
+		"motive_banlist":  "is in the ban list: {{.Lists}}",
+		"check_risk":      "Risk: {{.Score}}, {{.Action}}.",
+		"check_signal":    "{{.Name}}: +{{.Score}}{{if .Evidence}} ({{.Evidence}}){{end}}",
+		"risk_allow":      "allow",
+		"risk_probation":  "probation",
+		"risk_captcha":    "captcha",
+		"risk_kick":       "kick",
+		"importlist":      "The blocklist of {{.Issuer}} was imported: {{.Users}} new users and {{.Groups}} new groups.",
+		"import_usage":    "Usage: /importlist, sending or replying to the blocklist file.",
+		"import_failed":   "I couldn't import the blocklist, see the log of the bot.",
+		"welcome_usage":   "Usage: /welcome preview",
+		"welcome_set":     "The welcome message was changed.",
+		"welcome_reset":   "The welcome message is the default again.",
+		"welcome_invalid": "Invalid welcome message: {{.Error}}",
+		"audit_user":      "User",
+		"audit_chat":      "Chat",
+		"audit_reason":    "Reason",
+		"audit_actor":     "By",
+	},
+}
+
+// templates are the parsed catalog by parse mode
+var templates = map[string]map[string]map[string]*template.Template{
+	modePlain:               parseCatalog(catalog, modePlain),
+	telegram.ModeHTML:       parseCatalog(catalog, telegram.ModeHTML),
+	telegram.ModeMarkdownV2: parseCatalog(catalog, telegram.ModeMarkdownV2),
+}
+
+// parseCatalog parse all the templates with their text escaped for the
+// parse mode, panicking on invalid ones
+func parseCatalog(catalog map[string]map[string]string, mode string) map[string]map[string]*template.Template {
+	parsed := make(map[string]map[string]*template.Template, len(catalog))
+	for locale, messages := range catalog {
+		parsed[locale] = make(map[string]*template.Template, len(messages))
+		for id, text := range messages {
+			tmpl := template.Must(template.New(locale + "/" + id).Parse(text))
+			escapeNodes(mode, tmpl.Tree.Root)
+			parsed[locale][id] = tmpl
+		}
+	}
+	return parsed
+}
+
+// chatLocale return the locale of the chat
+func chatLocale(chatID int64) string {
+	if locale := settingsFor(chatID).Locale; locale != "" {
+		return locale
+	}
+	return defaultLocale
+}
+
+// format render the message in the locale and parse mode, escaping the
+// variables, falling back to the default locale when the locale or the
+// message is missing there
+func format(mode string, locale string, id string, data vars) formatted {
+	tmpl, ok := templates[mode][locale][id]
+	if !ok {
+		tmpl, ok = templates[mode][defaultLocale][id]
+	}
+	if !ok {
+		log.Printf("[!] Message %q not found", id)
+		return formatted(id)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, escapeVars(mode, data)); err != nil {
+		log.Printf("[!] Rendering message %q failed: %v", id, err)
+		return formatted(id)
+	}
+	return formatted(buf.String())
+}
+
+// tr render the message in the locale as plain text
+func tr(locale string, id string, data vars) string {
+	return string(format(modePlain, locale, id, data))
+}
+
+// chatFormat render the message in the locale and parse mode of the chat
+func chatFormat(chatID int64, id string, data vars) formatted {
+	return format(chatMode(chatID), chatLocale(chatID), id, data)
+}
+
+// replyMessage reply the message in the locale of the chat
+func replyMessage(bot TrollShieldBot, update *telegram.Update, id string, data vars) telegram.Message {
+	return reply(bot, update, chatFormat(update.Message.Chat.ID, id, data))
+}
+
+// formatDuration return a human readable duration in the locale
+func formatDuration(locale string, d Duration) string {
+	units := []struct {
+		size time.Duration
+		id   string
+	}{
+		{7 * 24 * time.Hour, "weeks"},
+		{24 * time.Hour, "days"},
+		{time.Hour, "hours"},
+		{time.Minute, "minutes"},
+	}
+	for _, unit := range units {
+		if n := time.Duration(d) / unit.size; n > 0 && time.Duration(d)%unit.size == 0 {
+			return tr(locale, unit.id, vars{"N": int(n)})
+		}
+	}
+	return time.Duration(d).String()
+}
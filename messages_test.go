@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCatalogCompleteness(t *testing.T) {
+	for locale, messages := range catalog {
+		for id := range catalog[defaultLocale] {
+			if _, ok := messages[id]; !ok {
+				t.Errorf("message %q is missing in locale %q", id, locale)
+			}
+		}
+		for id := range messages {
+			if _, ok := catalog[defaultLocale][id]; !ok {
+				t.Errorf("message %q of locale %q is missing in the default locale", id, locale)
+			}
+		}
+	}
+}
+
+func TestTr(t *testing.T) {
+	tableTest := []struct {
+		locale   string
+		id       string
+		data     vars
+		expected string
+	}{
+		{"pt", "ping", nil, "Estou vivo."},
+		{"en", "ping", nil, "I'm alive."},
+		{"xx", "ping", nil, "Estou vivo."},
+		{"en", "pass_added", vars{"Pass": "@lerax"}, `The pass for "@lerax" was added.`},
+		{"en", "no_such_message", nil, "no_such_message"},
+	}
+	for _, test := range tableTest {
+		if got := tr(test.locale, test.id, test.data); got != test.expected {
+			t.Errorf("tr(%q, %q): expected %q, got %q", test.locale, test.id, test.expected, got)
+		}
+	}
+}
+
+func TestChatLocale(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"chats": {"1": {"locale": "en"}}}`))
+	if got := chatLocale(1); got != "en" {
+		t.Errorf("chat 1 should use en, got %v", got)
+	}
+	if got := chatLocale(2); got != defaultLocale {
+		t.Errorf("chat 2 should use the default locale, got %v", got)
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tableTest := []struct {
+		locale   string
+		duration time.Duration
+		expected string
+	}{
+		{"pt", 24 * time.Hour, "1 dia"},
+		{"en", 24 * time.Hour, "1 day"},
+		{"en", 14 * 24 * time.Hour, "2 weeks"},
+		{"pt", 3 * time.Hour, "3 horas"},
+		{"en", 90 * time.Second, "1m30s"},
+	}
+	for _, test := range tableTest {
+		if got := formatDuration(test.locale, Duration(test.duration)); got != test.expected {
+			t.Errorf("formatDuration(%q, %v): expected %q, got %q", test.locale, test.duration, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// actions available to a KickPolicy
+const (
+	actionKick      = "kick"      // kick and unban, so the user can join again
+	actionBan       = "ban"       // ban for Duration
+	actionPermanent = "permanent" // ban forever
+	actionRestrict  = "restrict"  // read-only for Duration, or forever if zero
+	actionWarn      = "warn"      // only reply
+)
+
+// KickPolicy tells what to do with a troll
+type KickPolicy struct {
+	Action   string   `json:"action"`
+	Duration Duration `json:"duration,omitempty"`
+}
+
+// defaultLadder is used when neither a policy nor a ladder is configured
+var defaultLadder = []KickPolicy{
+	{Action: actionBan, Duration: Duration(24 * time.Hour)},
+	{Action: actionBan, Duration: Duration(7 * 24 * time.Hour)},
+	{Action: actionPermanent},
+}
+
+// removes return true if the action removes the user from the chat
+func removes(action string) bool {
+	return action == actionKick || action == actionBan || action == actionPermanent
+}
+
+// check return an error if the policy can't be applied, like a ban
+// without duration, which would be permanent
+func (p KickPolicy) check() error {
+	if p.Action == actionBan && p.Duration <= 0 {
+		return fmt.Errorf("ban policy without duration, use %q instead", actionPermanent)
+	}
+	return nil
+}
+
+// severity is used to choose the harshest policy among many troll houses
+func (p KickPolicy) severity() int64 {
+	switch p.Action {
+	case actionWarn:
+		return 0
+	case actionRestrict:
+		if p.Duration == 0 {
+			return int64(time.Hour) * 24 * 366
+		}
+		return int64(p.Duration)
+	case actionKick:
+		return int64(time.Hour) * 24 * 366
+	case actionBan:
+		return int64(time.Hour)*24*366 + int64(p.Duration)
+	case actionPermanent:
+		return 1 << 62
+	}
+	return -1
+}
+
+// splitHouses split the troll houses returned by findTrollHouses
+func splitHouses(trollHouse string) []string {
+	if trollHouse == "" {
+		return nil
+	}
+	return strings.Split(trollHouse, ", ")
+}
+
+// ladderStep return the step of the ladder for the previous offences,
+// staying on the last step after climbing the whole ladder
+func ladderStep(ladder []KickPolicy, offences int) KickPolicy {
+	if offences >= len(ladder) {
+		return ladder[len(ladder)-1]
+	}
+	return ladder[offences]
+}
+
+// resolvePolicy return the policy for the chat, choosing the harshest
+// policy of the troll houses when they have their own, otherwise
+// escalating through the ladder with the previous offences
+func resolvePolicy(chatID int64, houses []string, offences int) KickPolicy {
+	settings := settingsFor(chatID)
+	policy, found := KickPolicy{}, false
+	for _, house := range houses {
+		if p, ok := settings.GroupPolicies[house]; ok && (!found || p.severity() > policy.severity()) {
+			policy, found = p, true
+		}
+	}
+	switch {
+	case found:
+		return policy
+	case len(settings.Ladder) > 0:
+		return ladderStep(settings.Ladder, offences)
+	case settings.Policy.Action != "":
+		return settings.Policy
+	}
+	return ladderStep(defaultLadder, offences)
+}
+
+// untilDate return the unix time for a duration from now, or zero (forever)
+func untilDate(d Duration) int64 {
+	if d == 0 {
+		return 0
+	}
+	return time.Now().Add(time.Duration(d)).Unix()
+}
+
+// applyPolicy execute the policy over the chat member
+func applyPolicy(bot TrollShieldBot, chatMember telegram.ChatMemberConfig, policy KickPolicy) (telegram.APIResponse, error) {
+	switch policy.Action {
+	case actionWarn:
+		return telegram.APIResponse{Ok: true}, nil
+	case actionRestrict:
+		readOnly := false
+		return bot.RestrictChatMember(telegram.RestrictChatMemberConfig{
+			ChatMemberConfig:      chatMember,
+			UntilDate:             untilDate(policy.Duration),
+			CanSendMessages:       &readOnly,
+			CanSendMediaMessages:  &readOnly,
+			CanSendOtherMessages:  &readOnly,
+			CanAddWebPagePreviews: &readOnly,
+		})
+	case actionPermanent:
+		return bot.KickChatMember(telegram.KickChatMemberConfig{ChatMemberConfig: chatMember})
+	case actionKick:
+		resp, err := bot.KickChatMember(telegram.KickChatMemberConfig{ChatMemberConfig: chatMember})
+		if !resp.Ok || err != nil {
+			return resp, err
+		}
+		return bot.UnbanChatMember(chatMember)
+	case actionBan:
+		return bot.KickChatMember(telegram.KickChatMemberConfig{
+			ChatMemberConfig: chatMember,
+			UntilDate:        untilDate(policy.Duration),
+		})
+	}
+	return telegram.APIResponse{}, fmt.Errorf("unknown policy action %q", policy.Action)
+}
+
+// describePolicy return what happened to the user with that policy
+func describePolicy(locale string, policy KickPolicy) string {
+	duration := ""
+	if policy.Duration != 0 {
+		duration = formatDuration(locale, policy.Duration)
+	}
+	switch policy.Action {
+	case actionKick:
+		return tr(locale, "policy_kick", nil)
+	case actionBan:
+		return tr(locale, "policy_ban", vars{"Duration": duration})
+	case actionPermanent:
+		return tr(locale, "policy_perm", nil)
+	case actionRestrict:
+		return tr(locale, "policy_restrict", vars{"Duration": duration})
+	case actionWarn:
+		return tr(locale, "policy_warn", nil)
+	}
+	return policy.Action
+}
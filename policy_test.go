@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestParseDuration(t *testing.T) {
+	tableTest := []struct {
+		input    string
+		expected time.Duration
+	}{
+		{"90s", 90 * time.Second},
+		{"12h", 12 * time.Hour},
+		{"1d", 24 * time.Hour},
+		{"2w", 14 * 24 * time.Hour},
+	}
+	for _, test := range tableTest {
+		if got, err := parseDuration(test.input); err != nil || got != test.expected {
+			t.Errorf("parseDuration(%q): expected %v, got %v (%v)", test.input, test.expected, got, err)
+		}
+	}
+	if _, err := parseDuration("xd"); err == nil {
+		t.Errorf("parseDuration should fail with invalid days")
+	}
+	for _, input := range []string{"-1d", "-2h"} {
+		if _, err := parseDuration(input); err == nil {
+			t.Errorf("parseDuration(%q) should fail with a negative duration", input)
+		}
+	}
+}
+
+func TestParseConfigBanWithoutDuration(t *testing.T) {
+	for _, data := range []string{
+		`{"defaults": {"policy": {"action": "ban"}}}`,
+		`{"chats": {"-1": {"ladder": [{"action": "ban", "duration": "1d"}, {"action": "ban"}]}}}`,
+		`{"chats": {"-1": {"group_policies": {"@harsh": {"action": "ban"}}}}}`,
+		`{"defaults": {"warn_policy": {"action": "ban", "duration": "0s"}}}`,
+	} {
+		if _, err := parseConfig([]byte(data)); err == nil {
+			t.Errorf("parseConfig(%s) should reject a ban without duration", data)
+		}
+	}
+	if _, err := parseConfig([]byte(`{"defaults": {"policy": {"action": "ban", "duration": "1d"}}}`)); err != nil {
+		t.Errorf("parseConfig should accept a ban with duration, got %v", err)
+	}
+}
+
+func TestResolvePolicy(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{
+		"defaults": {"group_policies": {"@mild": {"action": "warn"}}},
+		"chats": {"1": {
+			"policy": {"action": "restrict", "duration": "1h"},
+			"group_policies": {"@harsh": {"action": "permanent"}}
+		}}
+	}`))
+
+	tableTest := []struct {
+		chatID   int64
+		houses   []string
+		expected string
+	}{
+		{1, []string{"@other"}, actionRestrict},
+		{1, []string{"@mild"}, actionWarn},
+		{1, []string{"@mild", "@harsh"}, actionPermanent},
+		{2, []string{"@harsh"}, actionBan},
+		{2, nil, actionBan},
+		{2, []string{"@mild"}, actionWarn},
+	}
+	for _, test := range tableTest {
+		if got := resolvePolicy(test.chatID, test.houses, 0); got.Action != test.expected {
+			t.Errorf("resolvePolicy(%v, %v): expected %v, got %v", test.chatID, test.houses, test.expected, got.Action)
+		}
+	}
+}
+
+func TestResolvePolicyLadder(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"chats": {
+		"1": {"ladder": [{"action": "warn"}, {"action": "kick"}]},
+		"2": {"policy": {"action": "restrict"}}
+	}}`))
+
+	tableTest := []struct {
+		chatID   int64
+		offences int
+		expected KickPolicy
+	}{
+		{1, 0, KickPolicy{Action: actionWarn}},
+		{1, 1, KickPolicy{Action: actionKick}},
+		{1, 5, KickPolicy{Action: actionKick}},
+		{2, 5, KickPolicy{Action: actionRestrict}},
+		{3, 0, defaultLadder[0]},
+		{3, 1, defaultLadder[1]},
+		{3, 2, KickPolicy{Action: actionPermanent}},
+		{3, 9, KickPolicy{Action: actionPermanent}},
+	}
+	for _, test := range tableTest {
+		if got := resolvePolicy(test.chatID, nil, test.offences); got != test.expected {
+			t.Errorf("resolvePolicy(%v, %v): expected %+v, got %+v", test.chatID, test.offences, test.expected, got)
+		}
+	}
+}
+
+func TestApplyPolicy(t *testing.T) {
+	bot := BotMockup{}
+	member := telegram.ChatMemberConfig{}
+	for _, action := range []string{actionKick, actionBan, actionPermanent, actionRestrict, actionWarn} {
+		if resp, err := applyPolicy(&bot, member, KickPolicy{Action: action}); !resp.Ok || err != nil {
+			t.Errorf("applyPolicy %v failed: %v", action, err)
+		}
+	}
+	if _, err := applyPolicy(&bot, member, KickPolicy{Action: "explode"}); err == nil {
+		t.Errorf("applyPolicy should fail with unknown action")
+	}
+	member.UserID = 1
+	if _, err := applyPolicy(&bot, member, KickPolicy{Action: actionKick}); err == nil {
+		t.Errorf("applyPolicy should fail when kick fails")
+	}
+}
+
+func TestDescribePolicy(t *testing.T) {
+	tableTest := []struct {
+		policy   KickPolicy
+		expected string
+	}{
+		{KickPolicy{Action: actionKick}, "removido"},
+		{KickPolicy{Action: actionBan, Duration: Duration(24 * time.Hour)}, "banido por 1 dia"},
+		{KickPolicy{Action: actionBan, Duration: Duration(14 * 24 * time.Hour)}, "banido por 2 semanas"},
+		{KickPolicy{Action: actionPermanent}, "banido permanentemente"},
+		{KickPolicy{Action: actionRestrict}, "restrito a somente leitura"},
+		{KickPolicy{Action: actionRestrict, Duration: Duration(90 * time.Minute)}, "restrito a somente leitura por 90 minutos"},
+		{KickPolicy{Action: actionWarn}, "avisado"},
+	}
+	for _, test := range tableTest {
+		if got := describePolicy("pt", test.policy); got != test.expected {
+			t.Errorf("describePolicy(%+v): expected %q, got %q", test.policy, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// forwarded return true if the message was forwarded from anywhere
+func forwarded(msg *telegram.Message) bool {
+	return msg.ForwardFrom != nil || msg.ForwardFromChat != nil
+}
+
+// restrictProbation allow the newcomer to send only text messages until
+// the end of the probation, when the chat restricts on probation
+func restrictProbation(bot TrollShieldBot, chatID int64, member telegram.User) {
+	settings := settingsFor(chatID)
+	if settings.Probation <= 0 || !settings.ProbationRestrict {
+		return
+	}
+	restrictMedia(bot, chatID, member, settings.Probation)
+}
+
+// restrictMedia allow the member to send only text messages for the
+// duration, recording it to be lifted by /approve
+func restrictMedia(bot TrollShieldBot, chatID int64, member telegram.User, d Duration) {
+	if member.IsBot || shadowMode(chatID) {
+		return
+	}
+	allowed, denied := true, false
+	resp, err := bot.RestrictChatMember(telegram.RestrictChatMemberConfig{
+		ChatMemberConfig:      telegram.ChatMemberConfig{ChatID: chatID, UserID: member.ID},
+		UntilDate:             untilDate(d),
+		CanSendMessages:       &allowed,
+		CanSendMediaMessages:  &denied,
+		CanSendOtherMessages:  &denied,
+		CanAddWebPagePreviews: &denied,
+	})
+	if !resp.Ok || err != nil {
+		log.Printf("[!] Restricting %v on probation failed, error code %v: %v", member.ID, resp.ErrorCode, resp.Description)
+		return
+	}
+	store.restrict(chatID, member, time.Now().Add(time.Duration(d)))
+}
+
+// checkProbation delete the links, media and forwards of members on
+// probation. Return true if the message was deleted.
+func checkProbation(bot TrollShieldBot, update *telegram.Update) bool {
+	if !messageEvent(update) || newChatMemberEvent(update) || update.Message.From == nil || update.Message.Chat.IsPrivate() {
+		return false
+	}
+	msg := update.Message
+	chatID := msg.Chat.ID
+	settings := settingsFor(chatID)
+	user := *msg.From
+	if settings.Probation <= 0 || fromAdminEvent(update) || store.trusted(user.ID) {
+		return false
+	}
+	if !store.onProbation(chatID, user.ID, time.Duration(settings.Probation), time.Now()) {
+		return false
+	}
+	if len(messageLinks(msg)) == 0 && !hasMedia(msg) && !forwarded(msg) {
+		return false
+	}
+
+	entry := AuditEntry{
+		ChatID:   chatID,
+		UserID:   user.ID,
+		UserName: getUserName(user),
+		Action:   "probation-delete",
+	}
+	if shadowMode(chatID) {
+		log.Printf("[shadow] message of %v on probation would be deleted", user.ID)
+		entry.Action = "shadow-" + entry.Action
+	} else {
+		deleteMessage(bot, chatID, msg.MessageID)
+	}
+	auditLog(bot, entry)
+	return true
+}
+
+// approveMember end the probation of the member, lifting only the
+// restriction of the probation or of the risk score, parse:
+// - /approve <@username|ID>
+// - /approve replying a message
+func approveMember(bot TrollShieldBot, update *telegram.Update) {
+	user, ok := resolveTarget(update)
+	if !ok {
+		replyMessage(bot, update, "target_usage", vars{"Command": "/approve"})
+		return
+	}
+	chatID := update.Message.Chat.ID
+	if store.approve(chatID, user) && !shadowMode(chatID) {
+		chatMember := telegram.ChatMemberConfig{ChatID: chatID, UserID: user.ID}
+		if resp, err := setSendPermissions(bot, chatMember, true); !resp.Ok || err != nil {
+			log.Printf("[!] Lifting probation of %v failed: %v", user.ID, err)
+		}
+	}
+	auditLog(bot, AuditEntry{
+		ChatID:   chatID,
+		UserID:   user.ID,
+		UserName: getUserName(user),
+		Action:   "approve",
+		Actor:    commandActor(update),
+	})
+	replyMessage(bot, update, "approve", vars{"User": user})
+}
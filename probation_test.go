@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestOnProbation(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+	user := telegram.User{ID: 1, UserName: "novato"}
+	store.seeMember(-1, user, true)
+	store.seeMember(-1, telegram.User{ID: 2}, false)
+	now := time.Now()
+
+	if !store.onProbation(-1, 1, time.Hour, now) {
+		t.Errorf("a newcomer should be on probation")
+	}
+	if store.onProbation(-1, 1, time.Hour, now.Add(2*time.Hour)) {
+		t.Errorf("the probation should end after the window")
+	}
+	if store.onProbation(-1, 2, time.Hour, now) {
+		t.Errorf("members not seen joining should not be on probation")
+	}
+	store.approve(-1, user)
+	if store.onProbation(-1, 1, time.Hour, now) {
+		t.Errorf("approved members should not be on probation")
+	}
+	store.seeMember(-1, user, true)
+	if !store.onProbation(-1, 1, time.Hour, now) {
+		t.Errorf("members joining again should be on probation again")
+	}
+}
+
+func TestCheckProbation(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	config, _ = parseConfig([]byte(`{"chats": {"-1": {"probation": "1d", "probation_restrict": true}}}`))
+	store = newStore("")
+	bot := DeleteMockup{deleted: make(chan int, 10)}
+	newcomer := telegram.User{ID: 0, UserName: "novato"}
+	store.seeMember(-1, newcomer, true)
+	message := func(id int) *telegram.Update {
+		return &telegram.Update{Message: &telegram.Message{
+			MessageID: id,
+			Text:      "olá",
+			From:      &newcomer,
+			Chat:      &telegram.Chat{ID: -1, Type: "supergroup"},
+		}}
+	}
+
+	if checkProbation(&bot, message(1)) {
+		t.Errorf("checkProbation should allow text messages")
+	}
+	update := message(2)
+	update.Message.ForwardFromChat = &telegram.Chat{ID: 5}
+	if !checkProbation(&bot, update) {
+		t.Errorf("checkProbation should delete forwards")
+	}
+	if id := <-bot.deleted; id != 2 {
+		t.Errorf("checkProbation should delete the message 2, got %v", id)
+	}
+	update = message(3)
+	update.Message.Entities = &[]telegram.MessageEntity{{Type: "text_link", URL: "https://spam.com"}}
+	if !checkProbation(&bot, update) {
+		t.Errorf("checkProbation should delete links")
+	}
+	<-bot.deleted
+
+	approve := &telegram.Update{Message: &telegram.Message{
+		Text: "/approve @novato",
+		From: &telegram.User{UserName: "lerax"},
+		Chat: &telegram.Chat{ID: -1, Type: "supergroup"},
+	}}
+	approveMember(&bot, approve)
+	if got := bot.lastText(); got != "@novato foi aprovado e não está mais em período de novato." {
+		t.Errorf("approveMember should reply the approval, got %q", got)
+	}
+	if checkProbation(&bot, update) {
+		t.Errorf("checkProbation should allow approved members")
+	}
+}
+
+func TestApproveRiskProbation(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	config, _ = parseConfig([]byte(`{"chats": {"-1": {"risk": {"probation": 1}}}}`))
+	store = newStore("")
+	update := telegram.Update{Message: &telegram.Message{
+		Text:           "/approve",
+		From:           &telegram.User{UserName: "lerax"},
+		Chat:           &telegram.Chat{ID: -1, Type: "supergroup"},
+		ReplyToMessage: &telegram.Message{From: &telegram.User{ID: 0}},
+	}}
+	bot := RestrictMockup{}
+	approveMember(&bot, &update)
+	if len(bot.restricted) != 0 {
+		t.Errorf("approveMember should not lift restrictions it didn't set, got %+v", bot.restricted)
+	}
+
+	bot = RestrictMockup{}
+	restrictMedia(&bot, -1, telegram.User{ID: 0}, Duration(time.Hour))
+	approveMember(&bot, &update)
+	if len(bot.restricted) != 2 || !*bot.restricted[1].CanSendMediaMessages {
+		t.Errorf("approveMember should lift the restriction of the risk probation, got %+v", bot.restricted)
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	defaultRaidInterval = 10 * time.Second
+	defaultRaidQuiet    = 10 * time.Minute
+	defaultRaidMute     = 24 * time.Hour
+)
+
+// readOnlyPermissions are the chat permissions set on lockdown
+var readOnlyPermissions = json.RawMessage(`{"can_send_messages":false}`)
+
+// lockdown is a chat under a join raid
+type lockdown struct {
+	// last join, the lockdown ends after a quiet period without joins
+	last  time.Time
+	timer *time.Timer
+	// permissions of the chat before the lockdown, when it was locked
+	permissions json.RawMessage
+}
+
+// raids are the recent joins and the lockdowns by chat
+var raids = struct {
+	sync.Mutex
+	joins  map[int64][]time.Time
+	locked map[int64]*lockdown
+}{
+	joins:  make(map[int64][]time.Time),
+	locked: make(map[int64]*lockdown),
+}
+
+// quietChats receive the chats in lockdown after their quiet period
+var quietChats = make(chan int64)
+
+// raidInterval return the size of the sliding window of joins
+func raidInterval(settings ChatSettings) time.Duration {
+	if settings.RaidInterval > 0 {
+		return time.Duration(settings.RaidInterval)
+	}
+	return defaultRaidInterval
+}
+
+// raidQuiet return how long without joins ends the lockdown
+func raidQuiet(settings ChatSettings) time.Duration {
+	if settings.RaidQuiet > 0 {
+		return time.Duration(settings.RaidQuiet)
+	}
+	return defaultRaidQuiet
+}
+
+// raidMute return how long the joiners are restricted on lockdown
+func raidMute(settings ChatSettings) Duration {
+	if settings.RaidMute > 0 {
+		return settings.RaidMute
+	}
+	return Duration(defaultRaidMute)
+}
+
+// countJoins add the joins to the sliding window of the chat, dropping
+// the old ones, and return how many joins are there
+func countJoins(chatID int64, now time.Time, n int, interval time.Duration) int {
+	raids.Lock()
+	defer raids.Unlock()
+	start := now.Add(-interval)
+	var joins []time.Time
+	for _, t := range raids.joins[chatID] {
+		if t.After(start) {
+			joins = append(joins, t)
+		}
+	}
+	for i := 0; i < n; i++ {
+		joins = append(joins, now)
+	}
+	raids.joins[chatID] = joins
+	return len(joins)
+}
+
+// lockedDown return true if the chat is in lockdown
+func lockedDown(chatID int64) bool {
+	raids.Lock()
+	defer raids.Unlock()
+	return raids.locked[chatID] != nil
+}
+
+// chatPermissions return the permissions of the chat, as sent by telegram
+func chatPermissions(bot TrollShieldBot, chatID int64) (json.RawMessage, error) {
+	resp, err := bot.MakeRequest("getChat", url.Values{"chat_id": {strconv.FormatInt(chatID, 10)}})
+	if err != nil {
+		return nil, err
+	}
+	var chat struct {
+		Permissions json.RawMessage `json:"permissions"`
+	}
+	if err := json.Unmarshal(resp.Result, &chat); err != nil {
+		return nil, err
+	}
+	return chat.Permissions, nil
+}
+
+// setChatPermissions change the default permissions of the chat members,
+// which is not available on the telegram library yet
+func setChatPermissions(bot TrollShieldBot, chatID int64, permissions json.RawMessage) error {
+	_, err := bot.MakeRequest("setChatPermissions", url.Values{
+		"chat_id":     {strconv.FormatInt(chatID, 10)},
+		"permissions": {string(permissions)},
+	})
+	return err
+}
+
+// checkRaid count the joins of the chat, putting it in lockdown past the
+// join rate limit. Return true if the chat is in lockdown.
+func checkRaid(bot TrollShieldBot, update *telegram.Update) bool {
+	chatID := update.Message.Chat.ID
+	settings := settingsFor(chatID)
+	if settings.RaidJoins <= 0 {
+		return false
+	}
+	now := time.Unix(int64(update.Message.Date), 0)
+	joins := countJoins(chatID, now, len(*update.Message.NewChatMembers), raidInterval(settings))
+
+	raids.Lock()
+	if lock := raids.locked[chatID]; lock != nil {
+		lock.last = time.Now()
+		raids.Unlock()
+		return true
+	}
+	if joins <= settings.RaidJoins {
+		raids.Unlock()
+		return false
+	}
+	lock := &lockdown{last: time.Now()}
+	lock.timer = time.AfterFunc(raidQuiet(settings), func() { quietChats <- chatID })
+	raids.locked[chatID] = lock
+	raids.Unlock()
+
+	startLockdown(bot, update, lock, joins, settings)
+	return true
+}
+
+// startLockdown lock the chat, if enabled, and alert the admins
+func startLockdown(bot TrollShieldBot, update *telegram.Update, lock *lockdown, joins int, settings ChatSettings) {
+	chatID := update.Message.Chat.ID
+	locale := chatLocale(chatID)
+	data := vars{
+		"Joins":    joins,
+		"Interval": formatDuration(locale, Duration(raidInterval(settings))),
+		"Mute":     formatDuration(locale, raidMute(settings)),
+	}
+	entry := AuditEntry{
+		ChatID: chatID,
+		Action: "lockdown",
+		Reason: fmt.Sprintf("%d joins", joins),
+	}
+	if shadowMode(chatID) {
+		log.Printf("[shadow] %v would be in lockdown after %v joins", chatID, joins)
+		entry.Action = "shadow-" + entry.Action
+		auditLog(bot, entry)
+		notifyAdmins(bot, update, chatFormat(chatID, "shadow_raid", data))
+		return
+	}
+
+	if settings.RaidLockChat {
+		permissions, err := chatPermissions(bot, chatID)
+		if err == nil {
+			err = setChatPermissions(bot, chatID, readOnlyPermissions)
+		}
+		if err != nil {
+			log.Printf("[!] Locking %v failed: %v", chatID, err)
+		} else {
+			raids.Lock()
+			lock.permissions = permissions
+			raids.Unlock()
+		}
+	}
+	auditLog(bot, entry)
+	notifyAdmins(bot, update, chatFormat(chatID, "raid_lockdown", data))
+}
+
+// restrictJoiner make the newcomer read-only during the lockdown
+func restrictJoiner(bot TrollShieldBot, update *telegram.Update, member telegram.User) {
+	chatID := update.Message.Chat.ID
+	if shadowMode(chatID) {
+		log.Printf("[shadow] %v would be restricted by the lockdown of %v", member.ID, chatID)
+		return
+	}
+	policy := KickPolicy{Action: actionRestrict, Duration: raidMute(settingsFor(chatID))}
+	chatMember := telegram.ChatMemberConfig{ChatID: chatID, UserID: member.ID}
+	if resp, err := applyPolicy(bot, chatMember, policy); !resp.Ok || err != nil {
+		log.Printf("[!] Restricting %v on lockdown failed, error code %v: %v", member.ID, resp.ErrorCode, resp.Description)
+		return
+	}
+	auditLog(bot, AuditEntry{
+		ChatID:   chatID,
+		UserID:   member.ID,
+		UserName: getUserName(member),
+		Action:   "lockdown-" + actionRestrict,
+	})
+}
+
+// endLockdown unlock the chat, restoring its permissions. Return false
+// if the chat was not in lockdown.
+func endLockdown(bot TrollShieldBot, update *telegram.Update, actor string) bool {
+	chatID := update.Message.Chat.ID
+	raids.Lock()
+	lock := raids.locked[chatID]
+	delete(raids.locked, chatID)
+	delete(raids.joins, chatID)
+	raids.Unlock()
+	if lock == nil {
+		return false
+	}
+	lock.timer.Stop()
+
+	if lock.permissions != nil {
+		if err := setChatPermissions(bot, chatID, lock.permissions); err != nil {
+			log.Printf("[!] Unlocking %v failed: %v", chatID, err)
+		}
+	}
+	auditLog(bot, AuditEntry{ChatID: chatID, Action: "unlock", Actor: actor})
+	replyMessage(bot, update, "raid_end", nil)
+	return true
+}
+
+// quietLockdown end the lockdown of the chat when there was no joins on
+// its quiet period, waiting the rest of it otherwise
+func quietLockdown(bot TrollShieldBot, chatID int64) {
+	quiet := raidQuiet(settingsFor(chatID))
+	raids.Lock()
+	lock := raids.locked[chatID]
+	if lock == nil {
+		raids.Unlock()
+		return
+	}
+	if wait := quiet - time.Since(lock.last); wait > 0 {
+		lock.timer.Reset(wait)
+		raids.Unlock()
+		return
+	}
+	raids.Unlock()
+	endLockdown(bot, chatUpdate(chatID), "")
+}
+
+// unlockChat end the lockdown of the chat, parse:
+// - /unlock
+func unlockChat(bot TrollShieldBot, update *telegram.Update) {
+	if !endLockdown(bot, update, commandActor(update)) {
+		replyMessage(bot, update, "raid_not_locked", nil)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+type RequestMockup struct {
+	SentMockup
+	requests []url.Values
+}
+
+func (bot *RequestMockup) MakeRequest(endpoint string, params url.Values) (telegram.APIResponse, error) {
+	params.Set("endpoint", endpoint)
+	bot.requests = append(bot.requests, params)
+	result := `{"permissions":{"can_send_messages":true}}`
+	return telegram.APIResponse{Ok: true, Result: []byte(result)}, nil
+}
+
+func TestCountJoins(t *testing.T) {
+	defer delete(raids.joins, -1)
+	tableTest := []struct {
+		second   int64
+		n        int
+		expected int
+	}{
+		{0, 1, 1},
+		{1, 2, 3},
+		{5, 1, 4},
+		{12, 1, 2},
+	}
+	for _, test := range tableTest {
+		if got := countJoins(-1, time.Unix(test.second, 0), test.n, 10*time.Second); got != test.expected {
+			t.Errorf("countJoins(%v, %v): expected %v, got %v", test.second, test.n, test.expected, got)
+		}
+	}
+}
+
+func TestCheckRaid(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"chats": {"-1": {"raid_joins": 2, "raid_quiet": "1h", "raid_lock_chat": true}}}`))
+	bot := RequestMockup{}
+	join := func(members ...telegram.User) *telegram.Update {
+		return &telegram.Update{Message: &telegram.Message{
+			Chat:           &telegram.Chat{ID: -1},
+			NewChatMembers: &members,
+		}}
+	}
+
+	if checkRaid(&bot, join(telegram.User{ID: 1}, telegram.User{ID: 2})) {
+		t.Errorf("checkRaid should allow joins within the limit")
+	}
+	if !checkRaid(&bot, join(telegram.User{ID: 3})) {
+		t.Errorf("checkRaid should start the lockdown past the limit")
+	}
+	if !lockedDown(-1) {
+		t.Errorf("the chat should be in lockdown")
+	}
+	if got := bot.lastText(); !strings.Contains(got, "Raid detectado: 3 entradas") {
+		t.Errorf("checkRaid should alert the admins, got %q", got)
+	}
+	if len(bot.requests) != 2 || bot.requests[1].Get("endpoint") != "setChatPermissions" ||
+		bot.requests[1].Get("permissions") != string(readOnlyPermissions) {
+		t.Errorf("checkRaid should make the chat read-only, got %v", bot.requests)
+	}
+
+	update := join(telegram.User{ID: 4})
+	if !checkRaid(&bot, update) {
+		t.Errorf("checkRaid should keep the lockdown")
+	}
+	restrictJoiner(&bot, update, telegram.User{ID: 0})
+
+	quietLockdown(&bot, -1)
+	if !lockedDown(-1) {
+		t.Errorf("quietLockdown should wait the quiet period")
+	}
+
+	update.Message.Text = "/unlock"
+	update.Message.From = &telegram.User{UserName: "lerax"}
+	unlockChat(&bot, update)
+	if lockedDown(-1) {
+		t.Errorf("unlockChat should end the lockdown")
+	}
+	if got := bot.requests[len(bot.requests)-1].Get("permissions"); got != `{"can_send_messages":true}` {
+		t.Errorf("unlockChat should restore the permissions, got %q", got)
+	}
+	if got := bot.lastText(); got != "O bloqueio do grupo foi encerrado." {
+		t.Errorf("unlockChat should announce the end, got %q", got)
+	}
+
+	unlockChat(&bot, update)
+	if got := bot.lastText(); got != "O grupo não está em bloqueio." {
+		t.Errorf("unlockChat should reply when not locked, got %q", got)
+	}
+}
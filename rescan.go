@@ -0,0 +1,105 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const defaultRescanDelay = 2 * time.Second
+
+// rescanHit is a known member found in a troll group
+type rescanHit struct {
+	chatID     int64
+	user       telegram.User
+	trollHouse string
+}
+
+// chatUpdate return an update from a chat without a message to reply,
+// used to act on chats outside of the telegram events
+func chatUpdate(chatID int64) *telegram.Update {
+	return &telegram.Update{Message: &telegram.Message{Chat: &telegram.Chat{ID: chatID}}}
+}
+
+// rescanRoster check all the members of the roster against the troll
+// groups, waiting delay between each member, sending the hits
+func rescanRoster(bot TrollShieldBot, delay time.Duration, hits chan<- rescanHit) {
+	for _, entry := range store.roster() {
+		if store.trusted(entry.UserID) || store.exempted(entry.UserID) {
+			continue
+		}
+		trollHouse := findTrollHouses(bot, entry.UserID)
+		store.checkedMember(entry.ChatID, entry.UserID)
+		if trollHouse != "" {
+			user := telegram.User{ID: entry.UserID, FirstName: entry.Name}
+			hits <- rescanHit{entry.ChatID, user, trollHouse}
+		}
+		time.Sleep(delay)
+	}
+}
+
+// startRescan re-scan the roster periodically, if enabled
+func startRescan(bot TrollShieldBot) <-chan rescanHit {
+	hits := make(chan rescanHit)
+	interval := time.Duration(config.RescanInterval)
+	if interval <= 0 {
+		return hits
+	}
+	delay := time.Duration(config.RescanDelay)
+	if delay <= 0 {
+		delay = defaultRescanDelay
+	}
+	go func() {
+		for range time.Tick(interval) {
+			log.Printf("Re-scanning the known members against the troll groups")
+			rescanRoster(bot, delay, hits)
+		}
+	}()
+	return hits
+}
+
+// handleRescanHit apply the kick policy or alert the admins, according
+// to the rescan action of the chat. Return true if the troll was kicked.
+func handleRescanHit(bot TrollShieldBot, hit rescanHit) bool {
+	update := chatUpdate(hit.chatID)
+	if settingsFor(hit.chatID).RescanAction == actionKick {
+		if err := kickTroll(bot, update, hit.user, hit.trollHouse); err != nil {
+			return false
+		}
+		store.forgetMember(hit.chatID, hit.user.ID)
+		return true
+	}
+
+	auditLog(bot, AuditEntry{
+		ChatID:   hit.chatID,
+		UserID:   hit.user.ID,
+		UserName: getUserName(hit.user),
+		Action:   "alert",
+		Reason:   hit.trollHouse,
+	})
+	notifyAdmins(bot, update, chatFormat(hit.chatID, "rescan_alert", vars{
+		"User":   hit.user,
+		"ID":     hit.user.ID,
+		"Houses": hit.trollHouse,
+	}))
+	return false
+}
+
+// updateRoster record the authors of messages on group chats and
+// forget the members leaving them, returning true if the author was
+// not seen before. The new members are recorded after being checked.
+func updateRoster(update *telegram.Update) bool {
+	if !messageEvent(update) || update.Message.Chat == nil || update.Message.Chat.IsPrivate() {
+		return false
+	}
+	chatID := update.Message.Chat.ID
+	if left := update.Message.LeftChatMember; left != nil {
+		store.forgetMember(chatID, left.ID)
+	} else if from := update.Message.From; from != nil && !newChatMemberEvent(update) {
+		return !store.seeMember(chatID, *from, false)
+	}
+	return false
+}
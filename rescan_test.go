@@ -0,0 +1,89 @@
+package main
+
+import (
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestUpdateRoster(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+	chat := telegram.Chat{ID: -1, Type: "supergroup"}
+	author := telegram.User{ID: 7, UserName: "author"}
+	update := telegram.Update{Message: &telegram.Message{Chat: &chat, From: &author}}
+
+	updateRoster(&update)
+	if store.Roster[-1][7] == nil {
+		t.Fatalf("message author should be in the roster")
+	}
+	if id, ok := store.userID("@author"); !ok || id != 7 {
+		t.Errorf("message author username should be remembered, got %v %v", id, ok)
+	}
+
+	update.Message.LeftChatMember = &author
+	updateRoster(&update)
+	if store.Roster[-1][7] != nil {
+		t.Errorf("member leaving the chat should be forgotten")
+	}
+
+	private := telegram.Chat{ID: 7, Type: "private"}
+	update = telegram.Update{Message: &telegram.Message{Chat: &private, From: &author}}
+	updateRoster(&update)
+	if len(store.Roster[7]) != 0 {
+		t.Errorf("private chats should not have roster")
+	}
+}
+
+func TestRescanRoster(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	defer func(g []string) { trollGroups = g }(trollGroups)
+	store = newStore("")
+	trollGroups = []string{"@rolisvaldo"}
+	chat := int64(-1)
+	// the mockup returns user 1 as member of any group, 4 as a left member
+	for _, id := range []int{1, 2, 4} {
+		store.seeMember(chat, telegram.User{ID: id}, true)
+	}
+	store.trust(telegram.User{ID: 2})
+
+	hits := make(chan rescanHit, 3)
+	bot := BotMockup{}
+	rescanRoster(&bot, 0, hits)
+	close(hits)
+
+	var found []rescanHit
+	for hit := range hits {
+		found = append(found, hit)
+	}
+	if len(found) != 1 || found[0].user.ID != 1 || found[0].trollHouse != "@rolisvaldo" {
+		t.Errorf("rescanRoster should find only user 1, got %+v", found)
+	}
+	if store.Roster[chat][4].Checked.IsZero() {
+		t.Errorf("checked time should be recorded")
+	}
+	if entries := store.roster(); entries[len(entries)-1].UserID == 2 {
+		t.Errorf("roster should return the least recently checked first, got %+v", entries)
+	}
+}
+
+func TestHandleRescanHit(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	defer func(c *Config) { config = c }(config)
+	store = newStore("")
+	config, _ = parseConfig([]byte(`{"chats": {"1": {"rescan_action": "kick"}}}`))
+	bot := BotMockup{}
+
+	// the mockup only kicks user 0
+	troll := telegram.User{ID: 0}
+	store.seeMember(1, troll, true)
+	if !handleRescanHit(&bot, rescanHit{1, troll, "@trollhouse"}) {
+		t.Errorf("handleRescanHit should kick on chats with kick action")
+	}
+	if store.Roster[1][0] != nil {
+		t.Errorf("kicked troll should be removed from roster")
+	}
+	if handleRescanHit(&bot, rescanHit{2, troll, "@trollhouse"}) {
+		t.Errorf("handleRescanHit should only alert by default")
+	}
+}
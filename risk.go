@@ -0,0 +1,293 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// risk signals, each one scored by the detector of the same name
+const (
+	riskTrollHouses  = "troll_houses"
+	riskBanLists     = "ban_lists"
+	riskNamePatterns = "name_patterns"
+	riskNoPhoto      = "no_photo"
+	riskNewAccount   = "new_account"
+	riskWeirdChars   = "weird_chars"
+	riskBadNames     = "bad_names"
+)
+
+// risk decisions, besides kick
+const (
+	riskAllow     = "allow"
+	riskProbation = "probation"
+	riskCaptcha   = "captcha"
+)
+
+// defaultRiskWeights are the scores of each hit of the signals
+var defaultRiskWeights = map[string]int{
+	riskTrollHouses:  100,
+	riskBanLists:     100,
+	riskNamePatterns: 30,
+	riskNoPhoto:      10,
+	riskNewAccount:   10,
+	riskWeirdChars:   30,
+	riskBadNames:     50,
+}
+
+const (
+	defaultRiskProbation = 24 * time.Hour
+	// zalgoMarks is how many combining marks in a row make a name zalgo
+	zalgoMarks = 3
+)
+
+// RiskSettings score the newcomers by the weighted signals, mapping the
+// total to the first threshold reached, from Kick to Probation. Zero
+// thresholds are disabled, and without any of them the scoring is off.
+type RiskSettings struct {
+	// Weights override the default score of each signal hit
+	Weights map[string]int `json:"weights"`
+	// NamePatterns are regular expressions matching the name or username
+	NamePatterns []string `json:"name_patterns"`
+	// BadNames are known bad names, matching any part of the name or
+	// username, ignoring the case
+	BadNames []string `json:"bad_names"`
+	// NewAccountID is the lowest user ID considered a recent account
+	NewAccountID int `json:"new_account_id"`
+
+	Probation int `json:"probation"`
+	Captcha   int `json:"captcha"`
+	Kick      int `json:"kick"`
+
+	patterns []*regexp.Regexp
+}
+
+// Signal is the score of one risk signal, with its evidence
+type Signal struct {
+	Name     string
+	Score    int
+	Evidence string
+}
+
+// compile the name patterns
+func (r *RiskSettings) compile() error {
+	r.patterns = make([]*regexp.Regexp, len(r.NamePatterns))
+	for i, pattern := range r.NamePatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		r.patterns[i] = re
+	}
+	return nil
+}
+
+// enabled return true when any threshold is set
+func (r *RiskSettings) enabled() bool {
+	return r.Probation > 0 || r.Captcha > 0 || r.Kick > 0
+}
+
+// weight return the score of one hit of the signal
+func (r *RiskSettings) weight(name string) int {
+	if weight, ok := r.Weights[name]; ok {
+		return weight
+	}
+	return defaultRiskWeights[name]
+}
+
+func detectNamePatterns(ctx context.Context, d Detection) (Verdict, error) {
+	var matches []string
+	for _, re := range d.Risk.patterns {
+		for _, name := range []string{fullName(d.User), d.User.UserName} {
+			if match := re.FindString(name); match != "" {
+				matches = append(matches, match)
+				break
+			}
+		}
+	}
+	return Verdict{Hits: len(matches), Evidence: matches}, nil
+}
+
+func detectNoPhoto(ctx context.Context, d Detection) (Verdict, error) {
+	photos, err := d.Bot.GetUserProfilePhotos(telegram.UserProfilePhotosConfig{UserID: d.User.ID, Limit: 1})
+	if err != nil || photos.TotalCount > 0 {
+		return Verdict{}, err
+	}
+	return Verdict{Hits: 1}, nil
+}
+
+func detectNewAccount(ctx context.Context, d Detection) (Verdict, error) {
+	if d.Risk.NewAccountID <= 0 || d.User.ID < d.Risk.NewAccountID {
+		return Verdict{}, nil
+	}
+	return Verdict{Hits: 1, Evidence: []string{fmt.Sprintf("ID %d", d.User.ID)}}, nil
+}
+
+func detectWeirdChars(ctx context.Context, d Detection) (Verdict, error) {
+	var found []string
+	name := fullName(d.User)
+	if strings.IndexFunc(name, bidiControl) >= 0 {
+		found = append(found, "RTL")
+	}
+	marks := 0
+	for _, r := range name {
+		if unicode.Is(unicode.Mn, r) {
+			marks++
+		} else {
+			marks = 0
+		}
+		if marks == zalgoMarks {
+			found = append(found, "zalgo")
+			break
+		}
+	}
+	if len(found) == 0 {
+		return Verdict{}, nil
+	}
+	return Verdict{Hits: 1, Evidence: found}, nil
+}
+
+// bidiControl return true for the characters changing the text direction
+func bidiControl(r rune) bool {
+	return r == '\u200e' || r == '\u200f' || r == '\u061c' ||
+		r >= '\u202a' && r <= '\u202e' ||
+		r >= '\u2066' && r <= '\u2069'
+}
+
+func detectBadNames(ctx context.Context, d Detection) (Verdict, error) {
+	var found []string
+	names := strings.ToLower(fullName(d.User) + "\n" + d.User.UserName)
+	for _, bad := range d.Risk.BadNames {
+		if bad != "" && strings.Contains(names, strings.ToLower(bad)) {
+			found = append(found, bad)
+		}
+	}
+	return Verdict{Hits: len(found), Evidence: found}, nil
+}
+
+// assessRisk score the verdicts of the detectors by their weights.
+// Return the total and the signals found.
+func assessRisk(verdicts map[string]Verdict, risk *RiskSettings) (int, []Signal) {
+	total := 0
+	var signals []Signal
+	for _, d := range detectors {
+		verdict := verdicts[d.name]
+		weight := risk.weight(d.name)
+		if verdict.Hits == 0 || weight == 0 {
+			continue
+		}
+		signal := Signal{
+			Name:     d.name,
+			Score:    verdict.Hits * weight,
+			Evidence: strings.Join(verdict.Evidence, ", "),
+		}
+		signals = append(signals, signal)
+		total += signal.Score
+	}
+	return total, signals
+}
+
+// riskDecision map the total score to an action by the thresholds.
+// Without a kick threshold, the flagged users, which are members of
+// troll houses or in ban lists, are still kicked.
+func riskDecision(risk *RiskSettings, total int, flagged bool) string {
+	switch {
+	case risk.Kick > 0 && total >= risk.Kick:
+		return actionKick
+	case risk.Kick <= 0 && flagged:
+		return actionKick
+	case risk.Captcha > 0 && total >= risk.Captcha:
+		return riskCaptcha
+	case risk.Probation > 0 && total >= risk.Probation:
+		return riskProbation
+	}
+	return riskAllow
+}
+
+// flagged return true if the user is a member of troll houses or in
+// ban lists by the verdicts
+func flagged(verdicts map[string]Verdict) bool {
+	return verdicts[riskTrollHouses].Hits > 0 || verdicts[riskBanLists].Hits > 0
+}
+
+// describeSignals return the signals as a reason for the audit log
+func describeSignals(total int, signals []Signal) string {
+	parts := make([]string, len(signals))
+	for i, signal := range signals {
+		parts[i] = fmt.Sprintf("%s=%d", signal.Name, signal.Score)
+		if signal.Evidence != "" {
+			parts[i] += " (" + signal.Evidence + ")"
+		}
+	}
+	return fmt.Sprintf("risk %d: %s", total, strings.Join(parts, ", "))
+}
+
+// screenMember run the detectors of the chat on the newcomer, kicking
+// the flagged ones or, when the chat scores the risk, choosing between
+// kicking, the captcha, the probation or just welcoming. Return true if
+// the newcomer was kicked.
+func screenMember(bot TrollShieldBot, botHidden TrollShieldBot, update *telegram.Update, member telegram.User, lockdown bool) bool {
+	chatID := update.Message.Chat.ID
+	settings := settingsFor(chatID)
+	verdicts := detect(bot, botHidden, update, member)
+
+	decision := riskAllow
+	if flagged(verdicts) {
+		decision = actionKick
+	}
+	total, signals := 0, []Signal(nil)
+	if settings.Risk.enabled() {
+		total, signals = assessRisk(verdicts, &settings.Risk)
+		decision = riskDecision(&settings.Risk, total, flagged(verdicts))
+		if decision != riskAllow && decision != actionKick {
+			auditLog(bot, AuditEntry{
+				ChatID:   chatID,
+				UserID:   member.ID,
+				UserName: getUserName(member),
+				Action:   "risk-" + decision,
+				Reason:   describeSignals(total, signals),
+			})
+		}
+	}
+
+	lists := verdicts[riskBanLists].Evidence
+	switch {
+	case decision == actionKick && verdicts[riskTrollHouses].Hits > 0:
+		return kickTroll(bot, update, member, strings.Join(verdicts[riskTrollHouses].Evidence, ", ")) == nil
+	case decision == actionKick && len(lists) > 0:
+		motive := tr(chatLocale(chatID), "motive_banlist", vars{"Lists": strings.Join(lists, ", ")})
+		return kickUser(bot, update, member, nil, "ban list: "+strings.Join(lists, ", "), motive) == nil
+	case decision == actionKick:
+		motive := tr(chatLocale(chatID), "motive_risk", vars{"Score": total})
+		return kickUser(bot, update, member, nil, describeSignals(total, signals), motive) == nil
+	case member.IsBot:
+		// the bots are neither challenged nor greeted
+		return false
+	case lockdown:
+		restrictJoiner(bot, update, member)
+		return false
+	case decision == riskCaptcha || settings.Captcha:
+		challengeMember(bot, update, member)
+		return false
+	case decision == riskProbation:
+		window := settings.Probation
+		if window <= 0 {
+			window = Duration(defaultRiskProbation)
+		}
+		restrictMedia(bot, chatID, member, window)
+	default:
+		restrictProbation(bot, chatID, member)
+	}
+	if settings.GreetAll {
+		welcomeMessage(bot, update, member)
+	}
+	return false
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// runDetectors run every detector on the user, failing on errors
+func runDetectors(t *testing.T, user telegram.User, risk *RiskSettings) map[string]Verdict {
+	verdicts := map[string]Verdict{}
+	input := Detection{Bot: &BotMockup{}, BotHidden: &BotMockup{}, User: user, Chat: &telegram.Chat{}, Risk: risk}
+	for _, d := range detectors {
+		verdict, err := d.detector.Detect(context.Background(), input)
+		if err != nil {
+			t.Fatalf("detector %v failed: %v", d.name, err)
+		}
+		verdicts[d.name] = verdict
+	}
+	return verdicts
+}
+
+func TestAssessRisk(t *testing.T) {
+	risk := RiskSettings{
+		Weights:      map[string]int{riskNoPhoto: 0},
+		NamePatterns: []string{`(?i)crypto`, `\d{4,}$`},
+		BadNames:     []string{"Rolisvaldo"},
+		NewAccountID: 5000,
+	}
+	if err := risk.compile(); err != nil {
+		t.Fatalf("compile failed: %v", err)
+	}
+	tableTest := []struct {
+		user     telegram.User
+		houses   []string
+		expected int
+	}{
+		{telegram.User{ID: 1, FirstName: "Fulano"}, nil, 0},
+		{telegram.User{ID: 1, FirstName: "Fulano"}, []string{"@mlbrasil", "@progclube"}, 200},
+		{telegram.User{ID: 1, FirstName: "CRYPTO", UserName: "trader12345"}, nil, 60},
+		{telegram.User{ID: 6000, FirstName: "Fulano"}, nil, 10},
+		{telegram.User{ID: 1, FirstName: "abc\u202egpj"}, nil, 30},
+		{telegram.User{ID: 1, FirstName: "Z\u0301\u0302\u0303algo"}, nil, 30},
+		{telegram.User{ID: 1, FirstName: "João"}, nil, 0},
+		{telegram.User{ID: 1, FirstName: "Fulano", UserName: "rolisvaldo_fan"}, nil, 50},
+	}
+	for _, test := range tableTest {
+		verdicts := runDetectors(t, test.user, &risk)
+		verdicts[riskTrollHouses] = Verdict{Hits: len(test.houses), Evidence: test.houses}
+		if got, signals := assessRisk(verdicts, &risk); got != test.expected {
+			t.Errorf("assessRisk(%+v): expected %v, got %v %+v", test.user, test.expected, got, signals)
+		}
+	}
+
+	risk.Weights = nil
+	total, signals := assessRisk(runDetectors(t, telegram.User{ID: 4}, &risk), &risk)
+	if total != 10 || len(signals) != 1 || signals[0].Name != riskNoPhoto {
+		t.Errorf("assessRisk should score users without photo, got %v %+v", total, signals)
+	}
+}
+
+func TestRiskDecision(t *testing.T) {
+	risk := RiskSettings{Probation: 10, Captcha: 30}
+	tableTest := []struct {
+		total    int
+		flagged  bool
+		expected string
+	}{
+		{0, false, riskAllow},
+		{10, false, riskProbation},
+		{40, false, riskCaptcha},
+		{10, true, actionKick},
+	}
+	for _, test := range tableTest {
+		if got := riskDecision(&risk, test.total, test.flagged); got != test.expected {
+			t.Errorf("riskDecision(%v, %v): expected %v, got %v", test.total, test.flagged, test.expected, got)
+		}
+	}
+	risk.Kick = 100
+	if got := riskDecision(&risk, 50, true); got != riskCaptcha {
+		t.Errorf("riskDecision should follow the kick threshold, got %v", got)
+	}
+}
+
+func TestScreenMember(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	config, _ = parseConfig([]byte(`{"chats": {"-1": {"greet_all": true, "risk": {
+		"name_patterns": ["(?i)crypto"], "kick": 40, "captcha": 100
+	}}}}`))
+	store = newStore("")
+	bot := SentMockup{}
+	update := telegram.Update{Message: &telegram.Message{Chat: &telegram.Chat{ID: -1}}}
+
+	if !screenMember(&bot, &bot, &update, telegram.User{ID: 0, FirstName: "Crypto", UserName: "king"}, false) {
+		t.Errorf("screenMember should kick above the threshold")
+	}
+	if got := bot.lastText(); !strings.Contains(got, "teve pontuação de risco 40") {
+		t.Errorf("screenMember should announce the risk score, got %q", got)
+	}
+
+	bot.sent = nil
+	if screenMember(&bot, &bot, &update, telegram.User{ID: 0, FirstName: "Fulano", UserName: "fulano"}, false) {
+		t.Errorf("screenMember should allow below the thresholds")
+	}
+	if len(bot.sent) != 1 {
+		t.Errorf("screenMember should greet the allowed newcomer, got %v messages", len(bot.sent))
+	}
+
+	bot.sent = nil
+	if screenMember(&bot, &bot, &update, telegram.User{ID: 0, FirstName: "Fulano", UserName: "fulano_bot", IsBot: true}, false) {
+		t.Errorf("screenMember should allow the bots below the thresholds")
+	}
+	if len(bot.sent) != 0 {
+		t.Errorf("screenMember should not greet the bots, got %v", bot.sent)
+	}
+}
+
+func TestCheckUserRisk(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"defaults": {"risk": {"kick": 100}}}`))
+	bot := SentMockup{}
+	update := telegram.Update{Message: &telegram.Message{
+		Text: "/check 4",
+		Chat: &telegram.Chat{},
+	}}
+
+	checkUser(&bot, &bot, &update)
+	if got := bot.lastText(); !strings.HasSuffix(got, "\nRisco: 10, permitir.\nno_photo: +10") {
+		t.Errorf("checkUser should show the risk breakdown, got %q", got)
+	}
+
+	// the check takes no action, not even the audit of the lookups
+	defer func(g []string) { trollGroups = g }(trollGroups)
+	trollGroups = []string{"@rolisvaldo", "@trolleira"}
+	config.LogChat = -5
+	bot = SentMockup{}
+	update.Message.Text = "/check 1"
+	checkUser(&bot, &bot, &update)
+	if got := bot.lastText(); len(bot.sent) != 1 || !strings.Contains(got, "troll_houses: +") || !strings.Contains(got, "(@rolisvaldo, @trolleira)") {
+		t.Errorf("checkUser should score the troll houses once, got %v", bot.sent)
+	}
+	update.Message.Text = "/check 99"
+	checkUser(&bot, &bot, &update)
+	if len(bot.sent) != 2 {
+		t.Errorf("checkUser should not audit the lookup errors, got %v", bot.sent)
+	}
+}
+
+func TestParseConfigRisk(t *testing.T) {
+	if _, err := parseConfig([]byte(`{"defaults": {"risk": {"name_patterns": ["("]}}}`)); err == nil {
+		t.Errorf("parseConfig should fail with invalid name patterns")
+	}
+}
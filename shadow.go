@@ -0,0 +1,77 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// shadowKillsFile keeps shadowKills between the runs
+var shadowKillsFile = "shadow-kills.txt"
+
+// shadowKills count how many trolls would have been kicked in shadow mode
+var shadowKills int64
+
+// errShadowMode is returned when an action was only simulated
+var errShadowMode = errors.New("shadow mode: no action was taken")
+
+// shadowMode return true if the actions on that chat should be only
+// simulated, the setting of the chat overrides the global one
+func shadowMode(chatID int64) bool {
+	if shadow := settingsFor(chatID).Shadow; shadow != nil {
+		return *shadow
+	}
+	return config.Shadow
+}
+
+// notifyAdmins reply mentioning all the admins
+func notifyAdmins(bot TrollShieldBot, update *telegram.Update, text formatted) {
+	mode := chatMode(update.Message.Chat.ID)
+	mentions := make([]string, len(admins))
+	for i, admin := range admins {
+		mentions[i] = escape(mode, "@"+admin)
+	}
+	reply(bot, update, formatted(fmt.Sprintf("%s %s", strings.Join(mentions, " "), text)))
+}
+
+// shadowKickTroll log and notify the admins about a troll that would be kicked
+func shadowKickTroll(bot TrollShieldBot, update *telegram.Update, user telegram.User, reason string, motive string, policy KickPolicy, offences int) error {
+	shadowKills++
+	if err := saveKills(shadowKillsFile, shadowKills); err != nil {
+		log.Printf("saving shadow kills failed: %v", err)
+	}
+
+	username := getUserName(user)
+	log.Printf("[shadow] %v (%v) would be %v from %v for: %v",
+		username, user.ID, policy.Action, update.Message.Chat.ID, reason,
+	)
+	auditLog(bot, AuditEntry{
+		ChatID:   update.Message.Chat.ID,
+		UserID:   user.ID,
+		UserName: username,
+		Action:   "shadow-" + policy.Action,
+		Reason:   reason,
+	})
+	chatID := update.Message.Chat.ID
+	locale := chatLocale(chatID)
+	notifyAdmins(bot, update, chatFormat(chatID, "shadow_kick", vars{
+		"User":     user,
+		"Action":   describePolicy(locale, policy),
+		"Motive":   motive,
+		"Offences": offences,
+		"Kills":    shadowKills,
+	}))
+
+	return errShadowMode
+}
+
+// shadowLeaveChat log and notify the admins that the bot would leave the chat
+func shadowLeaveChat(bot TrollShieldBot, update *telegram.Update, trollGroup string) {
+	log.Printf("[shadow] Bot would exit from %v", trollGroup)
+	notifyAdmins(bot, update, chatFormat(update.Message.Chat.ID, "shadow_leave", vars{"Group": trollGroup}))
+}
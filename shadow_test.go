@@ -0,0 +1,53 @@
+package main
+
+import (
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestShadowMode(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"chats": {"1": {"shadow": true}}}`))
+	if !shadowMode(1) {
+		t.Errorf("chat 1 should be in shadow mode")
+	}
+	if shadowMode(2) {
+		t.Errorf("chat 2 should not be in shadow mode")
+	}
+	config.Shadow = true
+	if !shadowMode(2) {
+		t.Errorf("global shadow mode should apply to chat 2")
+	}
+
+	config, _ = parseConfig([]byte(`{"shadow": true, "chats": {"1": {"shadow": false}}}`))
+	if shadowMode(1) {
+		t.Errorf("chat 1 should override the global shadow mode")
+	}
+	if !shadowMode(2) {
+		t.Errorf("chat 2 should use the global shadow mode")
+	}
+}
+
+func TestShadowKickTroll(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(kills int64) { shadowKills = kills }(shadowKills)
+	config = &Config{Shadow: true}
+	bot := BotMockup{}
+	update := telegram.Update{}
+	message := telegram.Message{}
+	chat := telegram.Chat{}
+	message.Chat = &chat
+	update.Message = &message
+
+	kills := shadowKills
+	user := telegram.User{ID: 1}
+	if err := kickTroll(&bot, &update, user, "@trollhouse"); err != errShadowMode {
+		t.Errorf("kickTroll in shadow mode should return errShadowMode, got: %v", err)
+	}
+	if shadowKills != kills+1 {
+		t.Errorf("shadow kills should be incremented, expected %v, got %v", kills+1, shadowKills)
+	}
+
+	leaveChat(&bot, &update, "trolleira")
+}
@@ -0,0 +1,31 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// deleteLater delete the message after the duration
+func deleteLater(bot TrollShieldBot, chatID int64, messageID int, d time.Duration) {
+	time.AfterFunc(d, func() {
+		deleteMessage(bot, chatID, messageID)
+	})
+}
+
+// announceRemoval reply the removal notice, unless the chat is in
+// silent removal, deleting it later when the chat has a removal TTL
+func announceRemoval(bot TrollShieldBot, update *telegram.Update, text formatted) {
+	chatID := update.Message.Chat.ID
+	settings := settingsFor(chatID)
+	if settings.SilentRemoval {
+		return
+	}
+	sent := reply(bot, update, text)
+	if settings.RemovalTTL > 0 && sent.MessageID != 0 {
+		deleteLater(bot, chatID, sent.MessageID, time.Duration(settings.RemovalTTL))
+	}
+}
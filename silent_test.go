@@ -0,0 +1,78 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// DeleteMockup record the deleted messages
+type DeleteMockup struct {
+	SentMockup
+	deleted chan int
+}
+
+func (bot *DeleteMockup) Send(c telegram.Chattable) (telegram.Message, error) {
+	bot.SentMockup.Send(c)
+	return telegram.Message{MessageID: 99}, nil
+}
+
+func (bot *DeleteMockup) DeleteMessage(c telegram.DeleteMessageConfig) (telegram.APIResponse, error) {
+	bot.deleted <- c.MessageID
+	return telegram.APIResponse{Ok: true}, nil
+}
+
+func TestAnnounceRemoval(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"chats": {
+		"1": {"silent_removal": true},
+		"2": {"removal_ttl": "10ms"}
+	}}`))
+	bot := DeleteMockup{deleted: make(chan int, 1)}
+
+	update := telegram.Update{Message: &telegram.Message{Chat: &telegram.Chat{ID: 1}}}
+	announceRemoval(&bot, &update, "removido")
+	if len(bot.sent) != 0 {
+		t.Errorf("silent removal should not announce, got %v", bot.sent)
+	}
+
+	update.Message.Chat.ID = 2
+	announceRemoval(&bot, &update, "removido")
+	if len(bot.sent) != 1 {
+		t.Errorf("removal should be announced, got %v", bot.sent)
+	}
+	select {
+	case id := <-bot.deleted:
+		if id != 99 {
+			t.Errorf("announcement 99 should be deleted, got %v", id)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("announcement should be deleted after the removal TTL")
+	}
+}
+
+func TestKickTrollDeleteJoinMessage(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+	config, _ = parseConfig([]byte(`{"chats": {"1": {"delete_join_message": true}}}`))
+	bot := DeleteMockup{deleted: make(chan int, 1)}
+	update := telegram.Update{Message: &telegram.Message{
+		MessageID:      7,
+		Chat:           &telegram.Chat{ID: 1},
+		NewChatMembers: &[]telegram.User{{ID: 0}},
+	}}
+
+	if err := kickTroll(&bot, &update, telegram.User{ID: 0}, "@trollhouse"); err != nil {
+		t.Fatalf("kickTroll failed: %v", err)
+	}
+	select {
+	case id := <-bot.deleted:
+		if id != 7 {
+			t.Errorf("join message 7 should be deleted, got %v", id)
+		}
+	default:
+		t.Errorf("join message should be deleted")
+	}
+}
@@ -0,0 +1,671 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// Offender is an user which had a policy applied at least once
+type Offender struct {
+	Name     string    `json:"name"`
+	Offences int       `json:"offences"`
+	Reason   string    `json:"reason,omitempty"`
+	LastKick time.Time `json:"last_kick"`
+	// Removed offenders were kicked or banned at least once, instead of
+	// only warned or restricted
+	Removed bool `json:"removed,omitempty"`
+}
+
+// Member is an user seen in a chat, by joining or sending messages
+type Member struct {
+	Name    string    `json:"name"`
+	Joined  time.Time `json:"joined,omitempty"`
+	Seen    time.Time `json:"seen"`
+	Checked time.Time `json:"checked,omitempty"`
+	// Approved members are not on probation anymore
+	Approved bool `json:"approved,omitempty"`
+	// Restricted is when the restriction of the probation, or of the
+	// risk score, ends
+	Restricted time.Time `json:"restricted,omitempty"`
+}
+
+// Warning is given by an admin, or by the filters, to a chat member
+type Warning struct {
+	Time   time.Time `json:"time"`
+	Reason string    `json:"reason,omitempty"`
+	Actor  string    `json:"actor,omitempty"`
+}
+
+// BlockedUser is an user shared by the blocklists of other instances,
+// with the issuers of the lists which had it as Sources
+type BlockedUser struct {
+	ID      int      `json:"id"`
+	Name    string   `json:"name,omitempty"`
+	Reasons []string `json:"reasons,omitempty"`
+	Sources []string `json:"sources"`
+}
+
+// BlockedGroup is a troll group shared by the blocklists
+type BlockedGroup struct {
+	Group   string   `json:"group"`
+	Sources []string `json:"sources"`
+}
+
+// Store is the persistent state of the bot, saved on every change
+type Store struct {
+	Offenders map[int]*Offender `json:"offenders"`
+	// Users map the known usernames, without @, to their IDs
+	Users map[string]int `json:"users"`
+	// Exempt users are never kicked automatically, the value is the name
+	Exempt map[int]string `json:"exempt"`
+	// Trusted users are never checked against the troll groups
+	Trusted map[int]string `json:"trusted"`
+	// Roster are the members seen by chat
+	Roster map[int64]map[int]*Member `json:"roster"`
+	// Welcome are the welcome templates set by /setwelcome
+	Welcome map[int64]string `json:"welcome"`
+	// Warnings are the warnings of the members by chat
+	Warnings map[int64]map[int][]Warning `json:"warnings"`
+	// BanLists are the user IDs imported from each external ban list,
+	// saved apart since they are big and only change on refresh
+	BanLists map[string][]int `json:"-"`
+	// Blocklist are the users imported from the blocklists of other
+	// instances, and BlockedGroups their troll groups with the sources
+	Blocklist     map[int]*BlockedUser `json:"blocklist"`
+	BlockedGroups map[string][]string  `json:"blocked_groups"`
+
+	// banned index the ban lists by user ID
+	banned       map[int]string
+	mu           sync.Mutex
+	path         string
+	banListsPath string
+}
+
+const (
+	storeFile    = "store.json"
+	banListsFile = "banlists.json"
+)
+
+// store is kept only in memory until loadStore is called
+var store = newStore("")
+
+func newStore(fpath string) *Store {
+	s := &Store{path: fpath}
+	s.init()
+	return s
+}
+
+// init allocate the maps missing after decoding
+func (s *Store) init() {
+	if s.Offenders == nil {
+		s.Offenders = make(map[int]*Offender)
+	}
+	if s.Users == nil {
+		s.Users = make(map[string]int)
+	}
+	if s.Exempt == nil {
+		s.Exempt = make(map[int]string)
+	}
+	if s.Trusted == nil {
+		s.Trusted = make(map[int]string)
+	}
+	if s.Roster == nil {
+		s.Roster = make(map[int64]map[int]*Member)
+	}
+	if s.Welcome == nil {
+		s.Welcome = make(map[int64]string)
+	}
+	if s.Warnings == nil {
+		s.Warnings = make(map[int64]map[int][]Warning)
+	}
+	if s.BanLists == nil {
+		s.BanLists = make(map[string][]int)
+	}
+	if s.Blocklist == nil {
+		s.Blocklist = make(map[int]*BlockedUser)
+	}
+	if s.BlockedGroups == nil {
+		s.BlockedGroups = make(map[string][]string)
+	}
+	s.indexBanLists()
+}
+
+// loadStore read the store from fpath, or start a new one
+func loadStore(fpath string) *Store {
+	s := newStore(fpath)
+	dat, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Reading %q failed: %v", fpath, err)
+		}
+		return s
+	}
+	if err := json.Unmarshal(dat, s); err != nil {
+		log.Printf("Parsing %q go bad, got error: %v", fpath, err)
+		return newStore(fpath)
+	}
+	s.init()
+	return s
+}
+
+// writeFile write and rename, so a crash never leaves a truncated file
+func writeFile(fpath string, dat []byte) error {
+	tmp := fpath + ".tmp"
+	if err := ioutil.WriteFile(tmp, dat, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fpath)
+}
+
+// save write the store to the disk, the caller must hold the lock
+func (s *Store) save() {
+	if s.path == "" {
+		return
+	}
+	dat, err := json.MarshalIndent(s, "", "  ")
+	if err == nil {
+		err = writeFile(s.path, dat)
+	}
+	if err != nil {
+		log.Printf("[!] Saving store failed: %v", err)
+	}
+}
+
+// loadBanLists read the ban lists saved in fpath, where they are saved
+// from now on
+func (s *Store) loadBanLists(fpath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.banListsPath = fpath
+	dat, err := ioutil.ReadFile(fpath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Reading %q failed: %v", fpath, err)
+		}
+		return
+	}
+	lists := make(map[string][]int)
+	if err := json.Unmarshal(dat, &lists); err != nil {
+		log.Printf("Parsing %q go bad, got error: %v", fpath, err)
+		return
+	}
+	s.BanLists = lists
+	s.indexBanLists()
+}
+
+// saveBanLists write the ban lists to the disk
+func (s *Store) saveBanLists() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.banListsPath == "" {
+		return
+	}
+	dat, err := json.Marshal(s.BanLists)
+	if err == nil {
+		err = writeFile(s.banListsPath, dat)
+	}
+	if err != nil {
+		log.Printf("[!] Saving ban lists failed: %v", err)
+	}
+}
+
+// offences return how many times a policy was applied to the user
+func (s *Store) offences(userID int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if offender, ok := s.Offenders[userID]; ok {
+		return offender.Offences
+	}
+	return 0
+}
+
+// addOffence record a new offence, punished by the action, and return
+// the total of offences
+func (s *Store) addOffence(user telegram.User, reason string, action string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	offender, ok := s.Offenders[user.ID]
+	if !ok {
+		offender = &Offender{}
+		s.Offenders[user.ID] = offender
+	}
+	s.rememberUser(user)
+	offender.Name = getUserName(user)
+	offender.Offences++
+	offender.Reason = reason
+	offender.LastKick = time.Now()
+	offender.Removed = offender.Removed || removes(action)
+	s.save()
+	return offender.Offences
+}
+
+// rememberUser keep the username of the user, the caller must hold the lock
+func (s *Store) rememberUser(user telegram.User) {
+	if user.UserName != "" {
+		s.Users[strings.ToLower(user.UserName)] = user.ID
+	}
+}
+
+// userID return the ID of a known @username
+func (s *Store) userID(username string) (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.Users[strings.ToLower(strings.TrimPrefix(username, "@"))]
+	return id, ok
+}
+
+// forgive remove one offence from the user
+func (s *Store) forgive(userID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if offender, ok := s.Offenders[userID]; ok && offender.Offences > 0 {
+		offender.Offences--
+		s.save()
+	}
+}
+
+// exempt exclude the user from the automated kicks
+func (s *Store) exempt(user telegram.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rememberUser(user)
+	s.Exempt[user.ID] = getUserName(user)
+	s.save()
+}
+
+// revoke the exemption of an user, return false if there was none
+func (s *Store) revoke(userID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Exempt[userID]; !ok {
+		return false
+	}
+	delete(s.Exempt, userID)
+	s.save()
+	return true
+}
+
+// exempted return true if the user is excluded from the automated kicks
+func (s *Store) exempted(userID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.Exempt[userID]
+	return ok
+}
+
+// trust add the user to the allowlist
+func (s *Store) trust(user telegram.User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rememberUser(user)
+	s.Trusted[user.ID] = getUserName(user)
+	s.save()
+}
+
+// untrust remove the user from the allowlist, return false if it wasn't there
+func (s *Store) untrust(userID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Trusted[userID]; !ok {
+		return false
+	}
+	delete(s.Trusted, userID)
+	s.save()
+	return true
+}
+
+// trusted return true if the user is in the allowlist
+func (s *Store) trusted(userID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.Trusted[userID]
+	return ok
+}
+
+// seeMember add the user to the roster of the chat, returning false
+// if the user was not known before. Only new members are saved right
+// away, the seen time of known members is saved by the next change.
+func (s *Store) seeMember(chatID int64, user telegram.User, joined bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	members, ok := s.Roster[chatID]
+	if !ok {
+		members = make(map[int]*Member)
+		s.Roster[chatID] = members
+	}
+	member, known := members[user.ID]
+	if !known {
+		member = &Member{}
+		members[user.ID] = member
+	}
+	member.Name = getUserName(user)
+	member.Seen = now
+	if joined {
+		member.Joined = now
+		member.Approved = false
+	}
+	if !known || joined {
+		s.rememberUser(user)
+		s.save()
+	}
+	return known
+}
+
+// joined return when the user joined the chat, zero if unknown
+func (s *Store) joined(chatID int64, userID int) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if member, ok := s.Roster[chatID][userID]; ok {
+		return member.Joined
+	}
+	return time.Time{}
+}
+
+// onProbation return true if the member joined the chat within the
+// window and was not approved
+func (s *Store) onProbation(chatID int64, userID int, window time.Duration, now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	member, ok := s.Roster[chatID][userID]
+	return ok && !member.Approved && !member.Joined.IsZero() && now.Sub(member.Joined) < window
+}
+
+// approve end the probation of the user on the chat, returning true if
+// it was still restricted by the probation
+func (s *Store) approve(chatID int64, user telegram.User) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	member := s.rosterMember(chatID, user)
+	restricted := member.Restricted.After(time.Now())
+	member.Approved = true
+	member.Restricted = time.Time{}
+	s.save()
+	return restricted
+}
+
+// restrict record until when the member is restricted on probation
+func (s *Store) restrict(chatID int64, user telegram.User, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rosterMember(chatID, user).Restricted = until
+	s.save()
+}
+
+// rosterMember return the member of the chat, adding it when unknown,
+// the caller must hold the lock
+func (s *Store) rosterMember(chatID int64, user telegram.User) *Member {
+	members, ok := s.Roster[chatID]
+	if !ok {
+		members = make(map[int]*Member)
+		s.Roster[chatID] = members
+	}
+	member, ok := members[user.ID]
+	if !ok {
+		member = &Member{Name: getUserName(user), Seen: time.Now()}
+		members[user.ID] = member
+	}
+	return member
+}
+
+// forgetMember remove the user from the roster of the chat
+func (s *Store) forgetMember(chatID int64, userID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Roster[chatID][userID]; ok {
+		delete(s.Roster[chatID], userID)
+		s.save()
+	}
+}
+
+// checkedMember record when the member was checked against the troll groups
+func (s *Store) checkedMember(chatID int64, userID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if member, ok := s.Roster[chatID][userID]; ok {
+		member.Checked = time.Now()
+	}
+}
+
+// RosterEntry is a member of a chat
+type RosterEntry struct {
+	ChatID  int64
+	UserID  int
+	Name    string
+	Checked time.Time
+}
+
+// roster return a copy of all members of all chats, the least
+// recently checked first
+func (s *Store) roster() []RosterEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []RosterEntry
+	for chatID, members := range s.Roster {
+		for userID, member := range members {
+			entries = append(entries, RosterEntry{chatID, userID, member.Name, member.Checked})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Checked.Before(entries[j].Checked)
+	})
+	return entries
+}
+
+// welcome return the welcome template set for the chat
+func (s *Store) welcome(chatID int64) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.Welcome[chatID]
+}
+
+// setWelcome set the welcome template of the chat, or remove it when empty
+func (s *Store) setWelcome(chatID int64, text string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if text == "" {
+		delete(s.Welcome, chatID)
+	} else {
+		s.Welcome[chatID] = text
+	}
+	s.save()
+}
+
+// activeWarnings return the warnings given after the expiry, the caller
+// must hold the lock
+func (s *Store) activeWarnings(chatID int64, userID int, expiry time.Duration, now time.Time) []Warning {
+	var active []Warning
+	for _, warning := range s.Warnings[chatID][userID] {
+		if now.Sub(warning.Time) < expiry {
+			active = append(active, warning)
+		}
+	}
+	return active
+}
+
+// warn add the warning to the user, dropping the expired ones, and
+// return the warnings still active
+func (s *Store) warn(chatID int64, user telegram.User, warning Warning, expiry time.Duration) []Warning {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	active := append(s.activeWarnings(chatID, user.ID, expiry, warning.Time), warning)
+	if _, ok := s.Warnings[chatID]; !ok {
+		s.Warnings[chatID] = make(map[int][]Warning)
+	}
+	s.Warnings[chatID][user.ID] = active
+	s.rememberUser(user)
+	s.save()
+	return active
+}
+
+// warnings return the active warnings of the user on the chat
+func (s *Store) warnings(chatID int64, userID int, expiry time.Duration) []Warning {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeWarnings(chatID, userID, expiry, time.Now())
+}
+
+// clearWarnings remove all the warnings of the user on the chat
+func (s *Store) clearWarnings(chatID int64, userID int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.Warnings[chatID][userID]; ok {
+		delete(s.Warnings[chatID], userID)
+		s.save()
+	}
+}
+
+// indexBanLists rebuild the index of the ban lists, the caller must
+// hold the lock
+func (s *Store) indexBanLists() {
+	s.banned = make(map[int]string)
+	for source, ids := range s.BanLists {
+		for _, id := range ids {
+			s.banned[id] = source
+		}
+	}
+}
+
+// setBanList replace the users imported from the ban list, without
+// saving it
+func (s *Store) setBanList(source string, ids []int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.BanLists[source] = ids
+	s.indexBanLists()
+}
+
+// keepBanLists forget the ban lists other than the sources, without
+// saving them
+func (s *Store) keepBanLists(sources []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changed := false
+	for source := range s.BanLists {
+		if !contains(sources, source) {
+			delete(s.BanLists, source)
+			changed = true
+		}
+	}
+	if changed {
+		s.indexBanLists()
+	}
+}
+
+// bannedBy return the ban list with the user, or the issuers of the
+// blocklists with it. Otherwise, return an empty string.
+func (s *Store) bannedBy(userID int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if source, ok := s.banned[userID]; ok {
+		return source
+	}
+	if blocked, ok := s.Blocklist[userID]; ok {
+		return strings.Join(blocked.Sources, ", ")
+	}
+	return ""
+}
+
+// merge add the values missing in the list
+func merge(list []string, values ...string) []string {
+	for _, value := range values {
+		if value != "" && !contains(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
+
+// mergeBlocklist add the users and groups of the blocklist, keeping the
+// sources and reasons of the ones already known. Return how many users
+// and groups were new.
+func (s *Store) mergeBlocklist(list *Blocklist) (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	users, groups := 0, 0
+	for _, user := range list.Users {
+		blocked, ok := s.Blocklist[user.ID]
+		if !ok {
+			blocked = &BlockedUser{ID: user.ID, Name: user.Name}
+			s.Blocklist[user.ID] = blocked
+			users++
+		}
+		blocked.Reasons = merge(blocked.Reasons, user.Reasons...)
+		blocked.Sources = merge(blocked.Sources, user.Sources...)
+		blocked.Sources = merge(blocked.Sources, list.Issuer)
+	}
+	for _, group := range list.Groups {
+		key := strings.ToLower(group.Group)
+		sources, ok := s.BlockedGroups[key]
+		if !ok {
+			groups++
+		}
+		sources = merge(sources, group.Sources...)
+		s.BlockedGroups[key] = merge(sources, list.Issuer)
+	}
+	s.save()
+	return users, groups
+}
+
+// blockedGroups return the troll groups imported from the blocklists
+func (s *Store) blockedGroups() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	groups := make([]string, 0, len(s.BlockedGroups))
+	for group := range s.BlockedGroups {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// blocklist return the offenders and the imported users, except the
+// exempted and trusted ones, with the imported groups, by ID and name.
+// The offenders have the issuer as source.
+func (s *Store) blocklist(issuer string) ([]BlockedUser, []BlockedGroup) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	byID := make(map[int]*BlockedUser)
+	for id, blocked := range s.Blocklist {
+		copied := *blocked
+		byID[id] = &copied
+	}
+	for id, offender := range s.Offenders {
+		if !offender.Removed {
+			continue
+		}
+		blocked, ok := byID[id]
+		if !ok {
+			blocked = &BlockedUser{ID: id, Name: offender.Name}
+			byID[id] = blocked
+		}
+		blocked.Reasons = merge(append([]string(nil), blocked.Reasons...), offender.Reason)
+		blocked.Sources = merge(append([]string(nil), blocked.Sources...), issuer)
+	}
+	users := make([]BlockedUser, 0, len(byID))
+	for id, blocked := range byID {
+		_, exempted := s.Exempt[id]
+		_, trusted := s.Trusted[id]
+		if !exempted && !trusted {
+			users = append(users, *blocked)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+
+	groups := make([]BlockedGroup, 0, len(s.BlockedGroups))
+	for group, sources := range s.BlockedGroups {
+		groups = append(groups, BlockedGroup{Group: group, Sources: sources})
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Group < groups[j].Group })
+	return users, groups
+}
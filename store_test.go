@@ -0,0 +1,44 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestStoreOffences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "troll-shield")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fpath := filepath.Join(dir, "store.json")
+
+	s := loadStore(fpath)
+	user := telegram.User{ID: 42, UserName: "troll"}
+	if got := s.offences(user.ID); got != 0 {
+		t.Errorf("new user should have no offences, got %v", got)
+	}
+	s.addOffence(user, "@trollhouse", actionBan)
+	if got := s.addOffence(user, "@trollhouse", actionBan); got != 2 {
+		t.Errorf("addOffence should return 2, got %v", got)
+	}
+
+	s = loadStore(fpath)
+	if got := s.offences(user.ID); got != 2 {
+		t.Errorf("offences should be persisted, expected 2, got %v", got)
+	}
+	if name := s.Offenders[user.ID].Name; name != "@troll" {
+		t.Errorf("offender name should be @troll, got %v", name)
+	}
+
+	if err := ioutil.WriteFile(fpath, []byte("{invalid"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if s := loadStore(fpath); len(s.Offenders) != 0 {
+		t.Errorf("invalid store should be discarded, got %+v", s.Offenders)
+	}
+}
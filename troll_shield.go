@@ -4,14 +4,17 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	logger "log"
+	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
@@ -22,9 +25,15 @@ type TrollShieldBot interface {
 	GetChatMember(telegram.ChatConfigWithUser) (telegram.ChatMember, error)
 	KickChatMember(telegram.KickChatMemberConfig) (telegram.APIResponse, error)
 	UnbanChatMember(telegram.ChatMemberConfig) (telegram.APIResponse, error)
+	RestrictChatMember(telegram.RestrictChatMemberConfig) (telegram.APIResponse, error)
 	Send(telegram.Chattable) (telegram.Message, error)
+	GetChatMembersCount(telegram.ChatConfig) (int, error)
+	GetUserProfilePhotos(telegram.UserProfilePhotosConfig) (telegram.UserProfilePhotos, error)
+	GetFileDirectURL(string) (string, error)
+	MakeRequest(string, url.Values) (telegram.APIResponse, error)
+	DeleteMessage(telegram.DeleteMessageConfig) (telegram.APIResponse, error)
+	AnswerCallbackQuery(telegram.CallbackConfig) (telegram.APIResponse, error)
 	LeaveChat(telegram.ChatConfig) (telegram.APIResponse, error)
-	GetUpdatesChan(telegram.UpdateConfig) (telegram.UpdatesChannel, error)
 }
 
 // blacklist groups, member from that groups will be kicked automatically
@@ -45,6 +54,10 @@ var admins = []string{
 	"renan_r",
 }
 
+// botRequestTimeout bounds the requests to telegram, longer than the long
+// polling of getUpdates
+const botRequestTimeout = 90 * time.Second
+
 const logfile = "troll-shield.log"
 const killsFile = "kills.txt"
 
@@ -80,86 +93,219 @@ func getUserName(user telegram.User) string {
 	return username
 }
 
-func getUpdates(bot TrollShieldBot) telegram.UpdatesChannel {
-	u := telegram.NewUpdate(0)
-	u.Timeout = 60
-	updates, err := bot.GetUpdatesChan(u)
-	if err != nil {
-		log.Printf("getUpdates error: %v", err)
+// Update is a telegram update with the sender_chat of its message,
+// which the telegram library drops
+type Update struct {
+	telegram.Update
+	SenderChat *telegram.Chat
+}
+
+// decodeUpdates decode the result of getUpdates, keeping the sender_chat
+func decodeUpdates(result json.RawMessage) ([]Update, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(result, &raws); err != nil {
+		return nil, err
+	}
+	updates := make([]Update, len(raws))
+	for i, raw := range raws {
+		var extra struct {
+			Message *struct {
+				SenderChat *telegram.Chat `json:"sender_chat"`
+			} `json:"message"`
+		}
+		if err := json.Unmarshal(raw, &updates[i].Update); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(raw, &extra); err != nil {
+			return nil, err
+		}
+		if extra.Message != nil {
+			updates[i].SenderChat = extra.Message.SenderChat
+		}
 	}
+	return updates, nil
+}
 
+// getUpdates poll the updates with long polling, retrying on failures
+func getUpdates(bot TrollShieldBot) <-chan Update {
+	updates := make(chan Update, 100)
+	go func() {
+		offset := 0
+		for {
+			resp, err := bot.MakeRequest("getUpdates", url.Values{
+				"offset":  {strconv.Itoa(offset)},
+				"timeout": {"60"},
+			})
+			var batch []Update
+			if err == nil {
+				batch, err = decodeUpdates(resp.Result)
+			}
+			if err != nil {
+				log.Printf("getUpdates error: %v", hideURL(err))
+				time.Sleep(3 * time.Second)
+				continue
+			}
+			for _, update := range batch {
+				if update.UpdateID >= offset {
+					offset = update.UpdateID + 1
+					updates <- update
+				}
+			}
+		}
+	}()
 	return updates
 }
 
-func reply(bot TrollShieldBot, update *telegram.Update, text string) {
-	msg := telegram.NewMessage(update.Message.Chat.ID, text)
+// reply a text formatted with the parse mode of the chat
+func reply(bot TrollShieldBot, update *telegram.Update, text formatted) telegram.Message {
+	msg := telegram.NewMessage(update.Message.Chat.ID, string(text))
 	msg.ReplyToMessageID = update.Message.MessageID
+	msg.ParseMode = chatMode(update.Message.Chat.ID)
 
-	_, err := bot.Send(msg)
+	sent, err := bot.Send(msg)
 	if err != nil {
 		log.Printf("[!] Send msg failed: %v", err)
 	}
+	return sent
 }
 
-func welcomeMessage(bot TrollShieldBot, update *telegram.Update, member telegram.User) {
-	username := getUserName(member)
-	text := fmt.Sprintf(
-		`Olá %s! Seja bem-vindo ao grupo oficial de Common Lisp do Brasil.
-Leia as regras em: https://lisp.com.br/rules.html.`,
-		username,
-	)
-	reply(bot, update, text)
+// TrollHouseStatus is the membership of an user in a troll group
+type TrollHouseStatus struct {
+	Group  string
+	Status string
+	Err    error
 }
 
-// findTrollHouses return a string with groups separeted by comma,
-// that groups are well-known to being troll houses.
-// otherwise, if nothing is found returns a empty string
-func findTrollHouses(bot TrollShieldBot, userID int) string {
-	ch := make(chan string, len(trollGroups))
-	var wait sync.WaitGroup
-	for _, trollGroup := range trollGroups {
-		wait.Add(1)
-		go func(group string) {
-			defer wait.Done()
-			c, _ := bot.GetChatMember(telegram.ChatConfigWithUser{
+// IsMember return true if the user is in the troll group
+func (s TrollHouseStatus) IsMember() bool {
+	return s.Status == "member" || s.Status == "creator" || s.Status == "administrator"
+}
+
+// trollHouses return the troll groups, followed by the ones imported
+// from the blocklists
+func trollHouses() []string {
+	houses := append([]string(nil), trollGroups...)
+	for _, group := range store.blockedGroups() {
+		known := false
+		for _, house := range houses {
+			known = known || strings.EqualFold(house, group)
+		}
+		if !known {
+			houses = append(houses, group)
+		}
+	}
+	return houses
+}
+
+// trollHouseStatus return the membership of the user in each troll group,
+// in the same order of trollHouses. The errors are without the URL of the
+// lookups, since they are shown in the chats. The lookups unfinished when
+// ctx is done fail with its error.
+func trollHouseStatus(ctx context.Context, bot TrollShieldBot, userID int) []TrollHouseStatus {
+	houses := trollHouses()
+	type lookup struct {
+		i      int
+		status TrollHouseStatus
+	}
+	lookups := make(chan lookup, len(houses))
+	for i, trollGroup := range houses {
+		go func(i int, group string) {
+			c, err := bot.GetChatMember(telegram.ChatConfigWithUser{
 				SuperGroupUsername: group,
 				UserID:             userID,
 			})
-			if c.IsMember() || c.IsCreator() || c.IsAdministrator() {
-				ch <- group
-			} else {
-				ch <- ""
-			}
-		}(trollGroup)
+			lookups <- lookup{i, TrollHouseStatus{Group: group, Status: c.Status, Err: hideURL(err)}}
+		}(i, trollGroup)
+	}
 
+	statuses := make([]TrollHouseStatus, len(houses))
+	done := make([]bool, len(houses))
+	for range houses {
+		select {
+		case l := <-lookups:
+			statuses[l.i] = l.status
+			done[l.i] = true
+		case <-ctx.Done():
+			for i, group := range houses {
+				if !done[i] {
+					statuses[i] = TrollHouseStatus{Group: group, Err: ctx.Err()}
+				}
+			}
+			return statuses
+		}
 	}
-	go func() {
-		wait.Wait()
-		close(ch)
-	}()
+	return statuses
+}
+
+// findTrollHouses return a string with groups separeted by comma,
+// that groups are well-known to being troll houses.
+// otherwise, if nothing is found returns a empty string
+func findTrollHouses(bot TrollShieldBot, userID int) string {
 	var houses []string
-	for house := range ch {
-		if house != "" {
-			houses = append(houses, house)
+	for _, status := range trollHouseStatus(context.Background(), bot, userID) {
+		if status.IsMember() {
+			houses = append(houses, status.Group)
 		}
 	}
 
 	return strings.Join(houses, ", ")
 }
 
-// kickTroll ban the troll and send a message about where we can found the trolls
+// checkTrollHouses find the troll houses of the user with botHidden
+// within ctx, recording the failed lookups with bot
+func checkTrollHouses(ctx context.Context, bot TrollShieldBot, botHidden TrollShieldBot, chatID int64, user telegram.User) string {
+	var houses []string
+	for _, status := range trollHouseStatus(ctx, botHidden, user.ID) {
+		if status.Err != nil {
+			log.Printf("[!] Checking %v on %v failed: %v", user.ID, status.Group, status.Err)
+			auditLog(bot, AuditEntry{
+				ChatID:   chatID,
+				UserID:   user.ID,
+				UserName: getUserName(user),
+				Action:   "check-error",
+				Reason:   fmt.Sprintf("%v: %v", status.Group, status.Err),
+			})
+		} else if status.IsMember() {
+			houses = append(houses, status.Group)
+		}
+	}
+	return strings.Join(houses, ", ")
+}
+
+// removalNotice return the message about the policy applied to the user
+func removalNotice(chatID int64, user telegram.User, policy KickPolicy, motive string, offences int) formatted {
+	return chatFormat(chatID, "removal", vars{
+		"User":     user,
+		"Action":   describePolicy(chatLocale(chatID), policy),
+		"Motive":   motive,
+		"Offences": offences,
+	})
+}
+
+// kickTroll apply the kick policy to the troll and send a message about where we can found the trolls
 func kickTroll(bot TrollShieldBot, update *telegram.Update, user telegram.User, trollHouse string) error {
+	motive := tr(chatLocale(update.Message.Chat.ID), "motive_troll", vars{"Houses": trollHouse})
+	return kickUser(bot, update, user, splitHouses(trollHouse), trollHouse, motive)
+}
+
+// kickUser apply the kick policy of the troll houses to the user,
+// recording the reason and announcing the motive
+func kickUser(bot TrollShieldBot, update *telegram.Update, user telegram.User, houses []string, reason string, motive string) error {
+	chatID := update.Message.Chat.ID
+	offences := store.offences(user.ID)
+	policy := resolvePolicy(chatID, houses, offences)
+	if store.exempted(user.ID) {
+		log.Printf("%v (%v) would be kicked for %v, but it is exempted", getUserName(user), user.ID, reason)
+		return errExempted
+	}
+	if shadowMode(chatID) {
+		return shadowKickTroll(bot, update, user, reason, motive, policy, offences+1)
+	}
 	chatMember := telegram.ChatMemberConfig{
-		ChatID: update.Message.Chat.ID,
+		ChatID: chatID,
 		UserID: user.ID,
 	}
-	resp, err := bot.KickChatMember(
-		telegram.KickChatMemberConfig{
-			ChatMemberConfig: chatMember,
-			UntilDate:        time.Now().AddDate(0, 0, 1).Unix(), // one day
-			//UntilDate: time.Now().Add(time.Minute * 1).Unix(), // one minute
-		},
-	)
+	resp, err := applyPolicy(bot, chatMember, policy)
 
 	if !resp.Ok || err != nil {
 		log.Printf(
@@ -168,11 +314,18 @@ func kickTroll(bot TrollShieldBot, update *telegram.Update, user telegram.User,
 		)
 	} else {
 		username := getUserName(user)
-		text := fmt.Sprintf(
-			"%v foi removido porque é membro do grupo: %v. Para mais informações, acione o nosso SAC 24h: @skhaz.",
-			username, trollHouse,
-		)
-		reply(bot, update, text)
+		if newChatMemberEvent(update) && settingsFor(chatID).DeleteJoinMessage {
+			defer deleteReplied(bot, update)
+		}
+		offences = store.addOffence(user, reason, policy.Action)
+		auditLog(bot, AuditEntry{
+			ChatID:   chatID,
+			UserID:   user.ID,
+			UserName: username,
+			Action:   policy.Action,
+			Reason:   reason,
+		})
+		announceRemoval(bot, update, removalNotice(chatID, user, policy, motive, offences))
 	}
 
 	return err
@@ -199,7 +352,8 @@ func setupBot(envVar string) (*telegram.BotAPI, error) {
 	if !exists {
 		return nil, fmt.Errorf("%s env should be defined", envVar)
 	}
-	bot, err := telegram.NewBotAPI(token)
+	client := &http.Client{Timeout: botRequestTimeout}
+	bot, err := telegram.NewBotAPIWithClient(token, telegram.APIEndpoint, client)
 
 	if err != nil {
 		return nil, fmt.Errorf("setup %v failed with: %v", envVar, err)
@@ -235,12 +389,18 @@ func setupBots() (*telegram.BotAPI, *telegram.BotAPI, error) {
 }
 
 func leaveChat(bot TrollShieldBot, update *telegram.Update, trollGroup string) {
-	reply(bot, update, "Nesse grupo há trolls. Dou-me a liberdade de ir embora. Adeus.")
+	if shadowMode(update.Message.Chat.ID) {
+		shadowLeaveChat(bot, update, trollGroup)
+		return
+	}
+	replyMessage(bot, update, "leave", nil)
 	r, err := bot.LeaveChat(telegram.ChatConfig{ChatID: update.Message.Chat.ID})
 	if !r.Ok || err != nil {
 		log.Printf("Bot tried to exit from %v, but failed with: %v",
 			trollGroup, err,
 		)
+	} else {
+		auditLog(bot, AuditEntry{ChatID: update.Message.Chat.ID, Action: "leave", Reason: trollGroup})
 	}
 }
 
@@ -270,11 +430,11 @@ func saveKills(fpath string, kills int64) error {
 }
 
 func reportKills(bot TrollShieldBot, update *telegram.Update, kills int64) {
-	txt := fmt.Sprintf("%v foram sacrificados.", kills)
+	id := "kills_odd"
 	if kills%2 == 0 {
-		txt = fmt.Sprintf("Já taquei o pau em %v trolls!", kills)
+		id = "kills_even"
 	}
-	reply(bot, update, txt)
+	replyMessage(bot, update, id, vars{"Kills": kills})
 }
 
 // parse:
@@ -287,11 +447,57 @@ func extractPassUserName(command string) string {
 	return strings.Join(tokens[1:n], " ")
 }
 
+// commandText return the text after the /command, keeping the line breaks
+func commandText(command string) string {
+	if i := strings.IndexAny(command, " \n"); i >= 0 {
+		return strings.TrimSpace(command[i:])
+	}
+	return ""
+}
+
+// commandArgs return the arguments after the /command
+func commandArgs(command string) []string {
+	fields := strings.Fields(command)
+	if len(fields) == 0 {
+		return nil
+	}
+	return fields[1:]
+}
+
+// parseTarget parse an @username known by the store or an user ID
+func parseTarget(arg string) (telegram.User, bool) {
+	if strings.HasPrefix(arg, "@") {
+		id, ok := store.userID(arg)
+		return telegram.User{ID: id, UserName: strings.TrimPrefix(arg, "@")}, ok
+	}
+	id, err := strconv.Atoi(arg)
+	if err != nil || id <= 0 {
+		return telegram.User{}, false
+	}
+	return telegram.User{ID: id, FirstName: arg}, true
+}
+
+// resolveTarget return the user targeted by an admin command:
+// - the author of the replied message
+// - /command <@username>
+// - /command <user ID>
+func resolveTarget(update *telegram.Update) (telegram.User, bool) {
+	msg := update.Message
+	if msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil {
+		return *msg.ReplyToMessage.From, true
+	}
+	args := commandArgs(msg.Text)
+	if len(args) == 0 {
+		return telegram.User{}, false
+	}
+	return parseTarget(args[0])
+}
+
 // If has pass, return true and and return the matched pass
 func hasPass(user telegram.User) (string, bool) {
 	userName := getUserName(user)
 	for _, pass := range passList {
-		if strings.HasPrefix(userName, pass) || user.FirstName == pass {
+		if strings.HasPrefix(userName, pass) || user.FirstName == pass || strconv.Itoa(user.ID) == pass {
 			return pass, true
 		}
 	}
@@ -310,7 +516,8 @@ func removePassList(bot TrollShieldBot, update *telegram.Update, pass string) {
 			passList = passList[:n-1]   // Truncate slice.
 		}
 	}
-	reply(bot, update, fmt.Sprintf("O passe para %q foi consumido.", pass))
+	auditLog(bot, AuditEntry{ChatID: update.Message.Chat.ID, Action: "pass-consumed", Reason: pass})
+	replyMessage(bot, update, "pass_consumed", vars{"Pass": pass})
 }
 
 // check if a message cames from a @commonlispbr admin
@@ -333,7 +540,13 @@ func addPassList(bot TrollShieldBot, update *telegram.Update) {
 	userName := extractPassUserName(update.Message.Text)
 	if len(userName) > 0 {
 		passList = append(passList, userName)
-		reply(bot, update, fmt.Sprintf("O passe para %q foi adicionado.", userName))
+		auditLog(bot, AuditEntry{
+			ChatID: update.Message.Chat.ID,
+			Action: "pass",
+			Reason: userName,
+			Actor:  commandActor(update),
+		})
+		replyMessage(bot, update, "pass_added", vars{"Pass": userName})
 	}
 }
 
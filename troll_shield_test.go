@@ -3,12 +3,28 @@ package main
 import (
 	"errors"
 	"io/ioutil"
+	"net/url"
 	"os"
+	"path/filepath"
 	"testing"
 
 	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
 )
 
+// TestMain keep the files written by the tests out of the working directory
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "troll-shield")
+	if err != nil {
+		log.Fatal(err)
+	}
+	shadowKillsFile = filepath.Join(dir, "shadow-kills.txt")
+	auditFile = filepath.Join(dir, "audit.jsonl")
+	blocklistQueueFile = filepath.Join(dir, "blocklist-queue.json")
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
 type BotMockup struct{}
 
 func (bot *BotMockup) GetChatMember(c telegram.ChatConfigWithUser) (telegram.ChatMember, error) {
@@ -46,10 +62,44 @@ func (bot *BotMockup) UnbanChatMember(c telegram.ChatMemberConfig) (telegram.API
 
 }
 
+func (bot *BotMockup) RestrictChatMember(c telegram.RestrictChatMemberConfig) (telegram.APIResponse, error) {
+	switch c.UserID {
+	case 0:
+		return telegram.APIResponse{Ok: true}, nil
+	default:
+		return telegram.APIResponse{Ok: false}, errors.New("error")
+	}
+}
+
 func (bot *BotMockup) Send(c telegram.Chattable) (telegram.Message, error) {
 	return telegram.Message{}, nil
 }
 
+func (bot *BotMockup) DeleteMessage(c telegram.DeleteMessageConfig) (telegram.APIResponse, error) {
+	return telegram.APIResponse{Ok: true}, nil
+}
+
+func (bot *BotMockup) AnswerCallbackQuery(c telegram.CallbackConfig) (telegram.APIResponse, error) {
+	return telegram.APIResponse{Ok: true}, nil
+}
+
+func (bot *BotMockup) GetChatMembersCount(c telegram.ChatConfig) (int, error) {
+	return 42, nil
+}
+
+// GetFileDirectURL use the file ID as the URL
+func (bot *BotMockup) GetFileDirectURL(fileID string) (string, error) {
+	return fileID, nil
+}
+
+func (bot *BotMockup) GetUserProfilePhotos(c telegram.UserProfilePhotosConfig) (telegram.UserProfilePhotos, error) {
+	return telegram.UserProfilePhotos{}, nil
+}
+
+func (bot *BotMockup) MakeRequest(endpoint string, params url.Values) (telegram.APIResponse, error) {
+	return telegram.APIResponse{Ok: true, Result: []byte(`{}`)}, nil
+}
+
 func (bot *BotMockup) LeaveChat(c telegram.ChatConfig) (telegram.APIResponse, error) {
 	switch c.ChatID {
 	case 1:
@@ -59,8 +109,26 @@ func (bot *BotMockup) LeaveChat(c telegram.ChatConfig) (telegram.APIResponse, er
 	}
 }
 
-func (bot *BotMockup) GetUpdatesChan(c telegram.UpdateConfig) (telegram.UpdatesChannel, error) {
-	return make(chan telegram.Update, 1), nil
+// SentMockup record the sent messages
+type SentMockup struct {
+	BotMockup
+	sent []telegram.Chattable
+}
+
+func (bot *SentMockup) Send(c telegram.Chattable) (telegram.Message, error) {
+	bot.sent = append(bot.sent, c)
+	return telegram.Message{}, nil
+}
+
+// lastText return the text of the last sent message
+func (bot *SentMockup) lastText() string {
+	if len(bot.sent) == 0 {
+		return ""
+	}
+	if msg, ok := bot.sent[len(bot.sent)-1].(telegram.MessageConfig); ok {
+		return msg.Text
+	}
+	return ""
 }
 
 func TestGetUserName(t *testing.T) {
@@ -224,9 +292,28 @@ func TestLeaveChat(t *testing.T) {
 	leaveChat(&bot, &update, "trolleira")
 }
 
+// UpdatesMockup answer getUpdates with the results, then blocks
+type UpdatesMockup struct {
+	BotMockup
+	results chan string
+}
+
+func (bot *UpdatesMockup) MakeRequest(endpoint string, params url.Values) (telegram.APIResponse, error) {
+	return telegram.APIResponse{Ok: true, Result: []byte(<-bot.results)}, nil
+}
+
 func TestGetUpdates(t *testing.T) {
-	bot := BotMockup{}
-	getUpdates(&bot)
+	bot := UpdatesMockup{results: make(chan string, 2)}
+	bot.results <- `[{"update_id": 1, "message": {"message_id": 2, "sender_chat": {"id": -100, "username": "trollchannel"}}}]`
+	bot.results <- `[{"update_id": 1}, {"update_id": 3, "message": {"message_id": 4}}]`
+	updates := getUpdates(&bot)
+	first := <-updates
+	if first.Message.MessageID != 2 || first.SenderChat == nil || first.SenderChat.UserName != "trollchannel" {
+		t.Errorf("getUpdates should keep the sender chat, got %+v", first)
+	}
+	if second := <-updates; second.UpdateID != 3 || second.SenderChat != nil {
+		t.Errorf("getUpdates should skip the seen updates, got %+v", second)
+	}
 }
 
 func TestSaveLoadKills(t *testing.T) {
@@ -0,0 +1,51 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// trustUser add the user to the allowlist, parse:
+// - /trust <@username|ID>
+// - /trust replying a message
+func trustUser(bot TrollShieldBot, update *telegram.Update) {
+	user, ok := resolveTarget(update)
+	if !ok {
+		replyMessage(bot, update, "target_usage", vars{"Command": "/trust"})
+		return
+	}
+	store.trust(user)
+	auditLog(bot, AuditEntry{
+		ChatID:   update.Message.Chat.ID,
+		UserID:   user.ID,
+		UserName: getUserName(user),
+		Action:   "trust",
+		Actor:    commandActor(update),
+	})
+	replyMessage(bot, update, "trust", vars{"User": user})
+}
+
+// untrustUser remove the user from the allowlist, parse:
+// - /untrust <@username|ID>
+// - /untrust replying a message
+func untrustUser(bot TrollShieldBot, update *telegram.Update) {
+	user, ok := resolveTarget(update)
+	if !ok {
+		replyMessage(bot, update, "target_usage", vars{"Command": "/untrust"})
+		return
+	}
+	if !store.untrust(user.ID) {
+		replyMessage(bot, update, "untrust_missing", vars{"User": user})
+		return
+	}
+	auditLog(bot, AuditEntry{
+		ChatID:   update.Message.Chat.ID,
+		UserID:   user.ID,
+		UserName: getUserName(user),
+		Action:   "untrust",
+		Actor:    commandActor(update),
+	})
+	replyMessage(bot, update, "untrust", vars{"User": user})
+}
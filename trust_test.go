@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestTrustUser(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+	bot := BotMockup{}
+	update := telegram.Update{Message: &telegram.Message{
+		Text: "/trust 42",
+		Chat: &telegram.Chat{},
+		From: &telegram.User{UserName: "lerax"},
+	}}
+
+	trustUser(&bot, &update)
+	if !store.trusted(42) {
+		t.Errorf("user 42 should be trusted")
+	}
+
+	update.Message.Text = "/untrust 42"
+	untrustUser(&bot, &update)
+	if store.trusted(42) {
+		t.Errorf("user 42 should not be trusted anymore")
+	}
+	untrustUser(&bot, &update)
+
+	update.Message.Text = "/trust"
+	trustUser(&bot, &update)
+	update.Message.Text = "/untrust"
+	untrustUser(&bot, &update)
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"errors"
+	"strconv"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// errExempted is returned when an exempted user would be kicked
+var errExempted = errors.New("user is exempted from automated kicks")
+
+// hasArg return true if the command has the argument
+func hasArg(command string, arg string) bool {
+	for _, a := range commandArgs(command) {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+// unbanUser reverse a false positive, parse:
+// - /unban <@username|ID> [pass]
+// - /unban [pass] replying a message
+// The user is exempted from automated kicks until /revoke
+func unbanUser(bot TrollShieldBot, update *telegram.Update) {
+	user, ok := resolveTarget(update)
+	if !ok {
+		replyMessage(bot, update, "unban_usage", nil)
+		return
+	}
+
+	chatID := update.Message.Chat.ID
+	resp, err := bot.UnbanChatMember(telegram.ChatMemberConfig{ChatID: chatID, UserID: user.ID})
+	if !resp.Ok || err != nil {
+		log.Printf("[!] Unban %v did not work, error code %v: %v", user.ID, resp.ErrorCode, resp.Description)
+		replyMessage(bot, update, "unban_failed", vars{"User": user})
+		return
+	}
+
+	store.forgive(user.ID)
+	store.exempt(user)
+	auditLog(bot, AuditEntry{
+		ChatID:   chatID,
+		UserID:   user.ID,
+		UserName: getUserName(user),
+		Action:   "unban",
+		Reason:   "false positive",
+		Actor:    commandActor(update),
+	})
+
+	pass := ""
+	if hasArg(update.Message.Text, "pass") {
+		pass = strconv.Itoa(user.ID)
+		passList = append(passList, pass)
+	}
+	replyMessage(bot, update, "unban", vars{"User": user, "Pass": pass})
+}
+
+// revokeExemption make the user subject to automated kicks again, parse:
+// - /revoke <@username|ID>
+// - /revoke replying a message
+func revokeExemption(bot TrollShieldBot, update *telegram.Update) {
+	user, ok := resolveTarget(update)
+	if !ok {
+		replyMessage(bot, update, "target_usage", vars{"Command": "/revoke"})
+		return
+	}
+	if !store.revoke(user.ID) {
+		replyMessage(bot, update, "revoke_missing", vars{"User": user})
+		return
+	}
+	auditLog(bot, AuditEntry{
+		ChatID:   update.Message.Chat.ID,
+		UserID:   user.ID,
+		UserName: getUserName(user),
+		Action:   "revoke",
+		Actor:    commandActor(update),
+	})
+	replyMessage(bot, update, "revoke", vars{"User": user})
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestResolveTarget(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+	store.Users["troll"] = 42
+
+	tableTest := []struct {
+		text     string
+		expected int
+		ok       bool
+	}{
+		{"/unban @troll", 42, true},
+		{"/unban @Troll pass", 42, true},
+		{"/unban 1234", 1234, true},
+		{"/unban @unknown", 0, false},
+		{"/unban lerax", 0, false},
+		{"/unban", 0, false},
+	}
+	for _, test := range tableTest {
+		update := telegram.Update{Message: &telegram.Message{Text: test.text}}
+		if user, ok := resolveTarget(&update); user.ID != test.expected || ok != test.ok {
+			t.Errorf("resolveTarget(%q): expected %v %v, got %v %v", test.text, test.expected, test.ok, user.ID, ok)
+		}
+	}
+
+	troll := telegram.User{ID: 7}
+	update := telegram.Update{Message: &telegram.Message{
+		Text:           "/unban",
+		ReplyToMessage: &telegram.Message{From: &troll},
+	}}
+	if user, ok := resolveTarget(&update); user.ID != 7 || !ok {
+		t.Errorf("resolveTarget should return the author of the replied message, got %v %v", user.ID, ok)
+	}
+}
+
+func TestUnbanUser(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	defer func(p []string) { passList = p }(passList)
+	store = newStore("")
+	bot := BotMockup{}
+	troll := telegram.User{ID: 0, UserName: "troll"}
+	store.addOffence(troll, "@trollhouse", actionBan)
+
+	update := telegram.Update{Message: &telegram.Message{
+		Text:           "/unban pass",
+		Chat:           &telegram.Chat{},
+		From:           &telegram.User{UserName: "lerax"},
+		ReplyToMessage: &telegram.Message{From: &troll},
+	}}
+	unbanUser(&bot, &update)
+	if !store.exempted(troll.ID) {
+		t.Errorf("unbanned user should be exempted")
+	}
+	if got := store.offences(troll.ID); got != 0 {
+		t.Errorf("false positive offence should be forgiven, got %v", got)
+	}
+	if _, ok := hasPass(telegram.User{ID: 0, FirstName: "Troll"}); !ok {
+		t.Errorf("unban with pass should add a pass for the user ID")
+	}
+	if err := kickTroll(&bot, &update, troll, "@trollhouse"); err != errExempted {
+		t.Errorf("kickTroll should not kick an exempted user, got %v", err)
+	}
+
+	update.Message.Text = "/revoke"
+	revokeExemption(&bot, &update)
+	if store.exempted(troll.ID) {
+		t.Errorf("revoked user should not be exempted")
+	}
+	revokeExemption(&bot, &update)
+
+	// unban fails for any user other than 0 in the mockup
+	update.Message.ReplyToMessage = nil
+	update.Message.Text = "/unban 5"
+	unbanUser(&bot, &update)
+	if store.exempted(5) {
+		t.Errorf("user should not be exempted when unban fails")
+	}
+	update.Message.Text = "/unban"
+	unbanUser(&bot, &update)
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"strings"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+const (
+	defaultWarnLimit  = 3
+	defaultWarnExpiry = 30 * 24 * time.Hour
+)
+
+// defaultWarnPolicy is applied when the warnings reach the limit
+var defaultWarnPolicy = KickPolicy{Action: actionRestrict, Duration: Duration(24 * time.Hour)}
+
+// warnLimit return how many warnings trigger the warn policy
+func warnLimit(settings ChatSettings) int {
+	if settings.WarnLimit > 0 {
+		return settings.WarnLimit
+	}
+	return defaultWarnLimit
+}
+
+// warnExpiry return how long the warnings last
+func warnExpiry(settings ChatSettings) time.Duration {
+	if settings.WarnExpiry > 0 {
+		return time.Duration(settings.WarnExpiry)
+	}
+	return defaultWarnExpiry
+}
+
+// warnPolicy return the policy applied when the warnings reach the limit
+func warnPolicy(settings ChatSettings) KickPolicy {
+	if settings.WarnPolicy.Action != "" {
+		return settings.WarnPolicy
+	}
+	return defaultWarnPolicy
+}
+
+// warnUser give a warning to the user, applying the warn policy when
+// the active warnings reach the limit of the chat
+func warnUser(bot TrollShieldBot, update *telegram.Update, user telegram.User, reason string, actor string) {
+	chatID := update.Message.Chat.ID
+	settings := settingsFor(chatID)
+	limit := warnLimit(settings)
+	warning := Warning{Time: time.Now(), Reason: reason, Actor: actor}
+	active := store.warn(chatID, user, warning, warnExpiry(settings))
+	auditLog(bot, AuditEntry{
+		ChatID:   chatID,
+		UserID:   user.ID,
+		UserName: getUserName(user),
+		Action:   actionWarn,
+		Reason:   reason,
+		Actor:    actor,
+	})
+	replyMessage(bot, update, "warn", vars{
+		"User":   user,
+		"Count":  len(active),
+		"Limit":  limit,
+		"Reason": reason,
+	})
+	if len(active) < limit {
+		return
+	}
+
+	policy := warnPolicy(settings)
+	if shadowMode(chatID) {
+		log.Printf("[shadow] %v (%v) would be %v from %v for warnings", getUserName(user), user.ID, policy.Action, chatID)
+		notifyAdmins(bot, update, chatFormat(chatID, "shadow_warns", vars{
+			"User":   user,
+			"Action": describePolicy(chatLocale(chatID), policy),
+		}))
+		return
+	}
+	chatMember := telegram.ChatMemberConfig{ChatID: chatID, UserID: user.ID}
+	if resp, err := applyPolicy(bot, chatMember, policy); !resp.Ok || err != nil {
+		log.Printf("[!] Applying warn policy to %v did not work, error code %v: %v", user.ID, resp.ErrorCode, resp.Description)
+		return
+	}
+	store.clearWarnings(chatID, user.ID)
+	offences := store.addOffence(user, "warnings", policy.Action)
+	auditLog(bot, AuditEntry{
+		ChatID:   chatID,
+		UserID:   user.ID,
+		UserName: getUserName(user),
+		Action:   policy.Action,
+		Reason:   "warnings",
+	})
+	motive := tr(chatLocale(chatID), "motive_warns", vars{"Limit": limit})
+	announceRemoval(bot, update, removalNotice(chatID, user, policy, motive, offences))
+}
+
+// warnCommand warn the author of the replied message, parse:
+// - /warn [reason] replying a message
+func warnCommand(bot TrollShieldBot, update *telegram.Update) {
+	replied := update.Message.ReplyToMessage
+	if replied == nil || replied.From == nil {
+		replyMessage(bot, update, "warn_usage", nil)
+		return
+	}
+	warnUser(bot, update, *replied.From, commandText(update.Message.Text), commandActor(update))
+}
+
+// listWarnings reply the active warnings of the user, parse:
+// - /warns <@username|ID>
+// - /warns replying a message
+func listWarnings(bot TrollShieldBot, update *telegram.Update) {
+	user, ok := resolveTarget(update)
+	if !ok {
+		replyMessage(bot, update, "target_usage", vars{"Command": "/warns"})
+		return
+	}
+	chatID := update.Message.Chat.ID
+	settings := settingsFor(chatID)
+	warnings := store.warnings(chatID, user.ID, warnExpiry(settings))
+	mode, locale := chatMode(chatID), chatLocale(chatID)
+	lines := []string{string(format(mode, locale, "warns", vars{
+		"User":  user,
+		"Count": len(warnings),
+		"Limit": warnLimit(settings),
+	}))}
+	for _, warning := range warnings {
+		lines = append(lines, string(format(mode, locale, "warns_item", vars{
+			"Time":   warning.Time.Format("2006-01-02 15:04"),
+			"Reason": warning.Reason,
+			"Actor":  warning.Actor,
+		})))
+	}
+	reply(bot, update, formatted(strings.Join(lines, "\n")))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestStoreWarnings(t *testing.T) {
+	s := newStore("")
+	user := telegram.User{ID: 1, UserName: "troll"}
+	old := Warning{Time: time.Now().Add(-2 * time.Hour), Reason: "velho"}
+	s.warn(-1, user, old, 24*time.Hour)
+	if active := s.warn(-1, user, Warning{Time: time.Now(), Reason: "novo"}, time.Hour); len(active) != 1 || active[0].Reason != "novo" {
+		t.Errorf("warn should drop the expired warnings, got %+v", active)
+	}
+	if got := s.warnings(-1, 1, time.Hour); len(got) != 1 {
+		t.Errorf("warnings expected 1 warning, got %+v", got)
+	}
+	if got := s.warnings(-2, 1, time.Hour); len(got) != 0 {
+		t.Errorf("warnings should be kept by chat, got %+v", got)
+	}
+	s.clearWarnings(-1, 1)
+	if got := s.warnings(-1, 1, time.Hour); len(got) != 0 {
+		t.Errorf("clearWarnings should remove the warnings, got %+v", got)
+	}
+}
+
+func TestWarnCommand(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	config, _ = parseConfig([]byte(`{"chats": {"-1": {"warn_limit": 2, "warn_policy": {"action": "ban", "duration": "1w"}}}}`))
+	store = newStore("")
+	bot := SentMockup{}
+	troll := telegram.User{ID: 0, UserName: "troll"}
+	update := telegram.Update{Message: &telegram.Message{
+		Text:           "/warn spam",
+		Chat:           &telegram.Chat{ID: -1},
+		From:           &telegram.User{UserName: "lerax"},
+		ReplyToMessage: &telegram.Message{MessageID: 10, From: &troll},
+	}}
+
+	warnCommand(&bot, &update)
+	if got := bot.lastText(); got != "@troll recebeu um aviso (1/2): spam." {
+		t.Errorf("warnCommand expected the first warning, got %q", got)
+	}
+
+	list := telegram.Update{Message: &telegram.Message{
+		Text: "/warns @troll",
+		Chat: &telegram.Chat{ID: -1},
+	}}
+	listWarnings(&bot, &list)
+	if got := bot.lastText(); !strings.HasPrefix(got, "Avisos de @troll: 1/2\n") || !strings.HasSuffix(got, ": spam (por @lerax)") {
+		t.Errorf("listWarnings should list the warnings, got %q", got)
+	}
+
+	warnCommand(&bot, &update)
+	if got := bot.lastText(); !strings.HasPrefix(got, "@troll foi banido por 1 semana porque atingiu 2 avisos") {
+		t.Errorf("warnCommand should apply the policy at the limit, got %q", got)
+	}
+	if got := store.warnings(-1, troll.ID, time.Hour); len(got) != 0 {
+		t.Errorf("the warnings should be cleared after the policy, got %+v", got)
+	}
+	if offences := store.offences(troll.ID); offences != 1 {
+		t.Errorf("warnCommand should record the offence, got %v", offences)
+	}
+
+	update.Message.ReplyToMessage = nil
+	warnCommand(&bot, &update)
+	if got := bot.lastText(); !strings.HasPrefix(got, "Uso: /warn") {
+		t.Errorf("warnCommand should reply the usage, got %q", got)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 the commonlispbr authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+package main
+
+import (
+	"bytes"
+	"strings"
+	"text/template"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+// WelcomeButton is an inline URL button sent with the welcome message
+type WelcomeButton struct {
+	Text string `json:"text"`
+	URL  string `json:"url"`
+}
+
+// fullName return the first and last names of the user
+func fullName(user telegram.User) string {
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
+
+// welcomeVars return the variables available to the welcome template
+func welcomeVars(bot TrollShieldBot, chat *telegram.Chat, member telegram.User) vars {
+	count, err := bot.GetChatMembersCount(telegram.ChatConfig{ChatID: chat.ID})
+	if err != nil {
+		log.Printf("[!] Counting members of %v failed: %v", chat.ID, err)
+	}
+	return vars{
+		"Name":        fullName(member),
+		"Mention":     member,
+		"ChatTitle":   chat.Title,
+		"MemberCount": count,
+	}
+}
+
+// renderWelcome render the welcome template of the chat, set by
+// /setwelcome or on the config, falling back to the default one. The
+// custom templates are written in the parse mode of the chat.
+func renderWelcome(chatID int64, data vars) formatted {
+	text := store.welcome(chatID)
+	if text == "" {
+		text = settingsFor(chatID).Welcome
+	}
+	if text != "" {
+		var buf bytes.Buffer
+		tmpl, err := template.New("welcome").Parse(text)
+		if err == nil {
+			err = tmpl.Execute(&buf, escapeVars(chatMode(chatID), data))
+		}
+		if err == nil {
+			return formatted(buf.String())
+		}
+		log.Printf("[!] Rendering the welcome of %v failed: %v", chatID, err)
+	}
+	return chatFormat(chatID, "welcome", data)
+}
+
+// welcomeButtons return the inline keyboard with the buttons of the chat
+func welcomeButtons(chatID int64) *telegram.InlineKeyboardMarkup {
+	buttons := settingsFor(chatID).WelcomeButtons
+	if len(buttons) == 0 {
+		return nil
+	}
+	var rows [][]telegram.InlineKeyboardButton
+	for _, button := range buttons {
+		rows = append(rows, telegram.NewInlineKeyboardRow(
+			telegram.NewInlineKeyboardButtonURL(button.Text, button.URL),
+		))
+	}
+	markup := telegram.NewInlineKeyboardMarkup(rows...)
+	return &markup
+}
+
+// welcomeMessage greet the member with the welcome of the chat
+func welcomeMessage(bot TrollShieldBot, update *telegram.Update, member telegram.User) {
+	chat := update.Message.Chat
+	msg := telegram.NewMessage(chat.ID, string(renderWelcome(chat.ID, welcomeVars(bot, chat, member))))
+	msg.ReplyToMessageID = update.Message.MessageID
+	msg.ParseMode = chatMode(chat.ID)
+	if markup := welcomeButtons(chat.ID); markup != nil {
+		msg.ReplyMarkup = markup
+	}
+	if _, err := bot.Send(msg); err != nil {
+		log.Printf("[!] Welcome message not sent: %v", err)
+	}
+}
+
+// setWelcome change the welcome template of the chat, parse:
+// - /setwelcome <template>
+// - /setwelcome, resetting it to the default
+func setWelcome(bot TrollShieldBot, update *telegram.Update) {
+	text := commandText(update.Message.Text)
+	if _, err := template.New("welcome").Parse(text); err != nil {
+		replyMessage(bot, update, "welcome_invalid", vars{"Error": err})
+		return
+	}
+	chatID := update.Message.Chat.ID
+	store.setWelcome(chatID, text)
+	auditLog(bot, AuditEntry{
+		ChatID: chatID,
+		Action: "set-welcome",
+		Reason: text,
+		Actor:  commandActor(update),
+	})
+	if text == "" {
+		replyMessage(bot, update, "welcome_reset", nil)
+	} else {
+		replyMessage(bot, update, "welcome_set", nil)
+	}
+}
+
+// previewWelcome greet who sent /welcome preview
+func previewWelcome(bot TrollShieldBot, update *telegram.Update) {
+	if !hasArg(update.Message.Text, "preview") || update.Message.From == nil {
+		replyMessage(bot, update, "welcome_usage", nil)
+		return
+	}
+	welcomeMessage(bot, update, *update.Message.From)
+}
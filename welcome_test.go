@@ -0,0 +1,118 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	telegram "github.com/go-telegram-bot-api/telegram-bot-api"
+)
+
+func TestCommandText(t *testing.T) {
+	tableTest := []struct {
+		command  string
+		expected string
+	}{
+		{"/setwelcome", ""},
+		{"/setwelcome Olá", "Olá"},
+		{"/setwelcome Olá {{.Mention}}!\nBem-vindo.", "Olá {{.Mention}}!\nBem-vindo."},
+		{"/setwelcome\nOlá", "Olá"},
+	}
+	for _, test := range tableTest {
+		if got := commandText(test.command); got != test.expected {
+			t.Errorf("commandText(%q): expected %q, got %q", test.command, test.expected, got)
+		}
+	}
+}
+
+func TestRenderWelcome(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	defer func(s *Store) { store = s }(store)
+	config, _ = parseConfig([]byte(`{"chats": {"2": {"welcome": "Oi {{.Name}}, {{.ChatTitle}} tem {{.MemberCount}} membros."}}}`))
+	store = newStore("")
+	bot := BotMockup{}
+	member := telegram.User{FirstName: "Manoel", LastName: "Neto", UserName: "lerax"}
+
+	data := welcomeVars(&bot, &telegram.Chat{ID: 1, Title: "Lisp"}, member)
+	if got := string(renderWelcome(1, data)); !strings.HasPrefix(got, "Olá @lerax! Seja bem-vindo") {
+		t.Errorf("renderWelcome should fall back to the default, got %q", got)
+	}
+
+	data = welcomeVars(&bot, &telegram.Chat{ID: 2, Title: "Lisp"}, member)
+	expected := "Oi Manoel Neto, Lisp tem 42 membros."
+	if got := string(renderWelcome(2, data)); got != expected {
+		t.Errorf("renderWelcome expected %q, got %q", expected, got)
+	}
+
+	store.setWelcome(2, "{{.Mention}} chegou")
+	if got := string(renderWelcome(2, data)); got != "@lerax chegou" {
+		t.Errorf("renderWelcome should prefer /setwelcome, got %q", got)
+	}
+
+	store.setWelcome(2, "{{index .Name 99}}")
+	if got := string(renderWelcome(2, data)); !strings.HasPrefix(got, "Olá @lerax!") {
+		t.Errorf("renderWelcome should fall back on failures, got %q", got)
+	}
+}
+
+func TestWelcomeButtons(t *testing.T) {
+	defer func(c *Config) { config = c }(config)
+	config, _ = parseConfig([]byte(`{"chats": {"1": {"welcome_buttons": [{"text": "Regras", "url": "https://lisp.com.br/rules.html"}]}}}`))
+	bot := SentMockup{}
+	update := telegram.Update{Message: &telegram.Message{MessageID: 5, Chat: &telegram.Chat{ID: 1}}}
+
+	welcomeMessage(&bot, &update, telegram.User{UserName: "lerax"})
+	msg := bot.sent[len(bot.sent)-1].(telegram.MessageConfig)
+	markup, ok := msg.ReplyMarkup.(*telegram.InlineKeyboardMarkup)
+	if !ok || len(markup.InlineKeyboard) != 1 || *markup.InlineKeyboard[0][0].URL != "https://lisp.com.br/rules.html" {
+		t.Errorf("welcomeMessage should send the buttons, got %+v", msg.ReplyMarkup)
+	}
+	if msg.ReplyToMessageID != 5 {
+		t.Errorf("welcomeMessage should reply the join message, got %v", msg.ReplyToMessageID)
+	}
+
+	update.Message.Chat.ID = 2
+	welcomeMessage(&bot, &update, telegram.User{UserName: "lerax"})
+	if msg := bot.sent[len(bot.sent)-1].(telegram.MessageConfig); msg.ReplyMarkup != nil {
+		t.Errorf("welcomeMessage should not send buttons by default, got %+v", msg.ReplyMarkup)
+	}
+}
+
+func TestSetWelcome(t *testing.T) {
+	defer func(s *Store) { store = s }(store)
+	store = newStore("")
+	bot := SentMockup{}
+	update := telegram.Update{Message: &telegram.Message{
+		Text: "/setwelcome Oi {{.Mention}}",
+		Chat: &telegram.Chat{ID: 1},
+		From: &telegram.User{UserName: "lerax"},
+	}}
+
+	setWelcome(&bot, &update)
+	if got := store.welcome(1); got != "Oi {{.Mention}}" {
+		t.Errorf("setWelcome should store the template, got %q", got)
+	}
+
+	update.Message.Text = "/welcome preview"
+	previewWelcome(&bot, &update)
+	if got := bot.lastText(); got != "Oi @lerax" {
+		t.Errorf("previewWelcome expected %q, got %q", "Oi @lerax", got)
+	}
+
+	update.Message.Text = "/welcome"
+	previewWelcome(&bot, &update)
+	if got := bot.lastText(); got != "Uso: /welcome preview" {
+		t.Errorf("previewWelcome should reply the usage, got %q", got)
+	}
+
+	update.Message.Text = "/setwelcome Oi {{.Mention"
+	setWelcome(&bot, &update)
+	if got := bot.lastText(); !strings.HasPrefix(got, "Mensagem de boas-vindas inválida") {
+		t.Errorf("setWelcome should refuse invalid templates, got %q", got)
+	}
+
+	update.Message.Text = "/setwelcome"
+	setWelcome(&bot, &update)
+	if got := store.welcome(1); got != "" {
+		t.Errorf("setWelcome should reset the template, got %q", got)
+	}
+}